@@ -0,0 +1,163 @@
+package muxify
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Principal is the authenticated subject of a request.
+type Principal struct {
+	// Subject identifies the principal, e.g. a username or the JWT "sub" claim.
+	Subject string
+	// Scheme is the authentication scheme, e.g. "Basic" or "Bearer".
+	Scheme string
+	// Scopes are the scopes granted to the principal.
+	Scopes []string
+	// Roles are the roles of the principal.
+	Roles []string
+	// Claims are the claims of a JWT.
+	Claims map[string]any
+}
+
+// ErrUnauthenticated is returned by validators for unknown credentials.
+var ErrUnauthenticated = errors.New("muxify: unauthenticated")
+
+// RequestPrincipal returns the principal that authenticated the request
+// or nil if the request is not authenticated.
+func RequestPrincipal(r *http.Request) *Principal {
+	p, _ := r.Context().Value(principalKey).(*Principal)
+	return p
+}
+
+// WithPrincipal returns a shallow copy of r with the principal stored in its context.
+// Custom authentication middlewares can use it to work with RequestPrincipal.
+func WithPrincipal(r *http.Request, p *Principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey, p))
+}
+
+// BasicValidator validates the credentials of HTTP Basic authentication
+// and returns the principal they belong to.
+type BasicValidator func(ctx context.Context, username, password string) (*Principal, error)
+
+// BasicAuthOptions configures the BasicAuth middleware.
+type BasicAuthOptions struct {
+	// Realm is sent in the WWW-Authenticate challenge.
+	Realm string
+	// Validate validates the credentials.
+	Validate BasicValidator
+}
+
+// BasicAuth returns a middleware that requires HTTP Basic authentication.
+// Unauthenticated requests are answered with 401 Unauthorized.
+func BasicAuth(opts BasicAuthOptions) Middleware {
+	challenge := `Basic realm="` + opts.Realm + `", charset="UTF-8"`
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			username, password, ok := r.BasicAuth()
+			if !ok {
+				unauthorized(w, challenge)
+				return
+			}
+
+			p, err := opts.Validate(r.Context(), username, password)
+			if err != nil || p == nil {
+				unauthorized(w, challenge)
+				return
+			}
+			if p.Scheme == "" {
+				p.Scheme = "Basic"
+			}
+
+			next.ServeHTTP(w, WithPrincipal(r, p))
+		})
+	}
+}
+
+// BasicUsers returns a BasicValidator for a static map of usernames and passwords.
+// Passwords are compared in constant time.
+func BasicUsers(users map[string]string) BasicValidator {
+	return func(ctx context.Context, username, password string) (*Principal, error) {
+		want, ok := users[username]
+		// compare anyway, so unknown users take as long as known ones
+		if !secureCompare(want, password) || !ok {
+			return nil, ErrUnauthenticated
+		}
+		return &Principal{Subject: username}, nil
+	}
+}
+
+// TokenValidator validates a bearer token and returns the principal it belongs to.
+type TokenValidator func(ctx context.Context, token string) (*Principal, error)
+
+// BearerAuthOptions configures the BearerAuth middleware.
+type BearerAuthOptions struct {
+	// Realm is sent in the WWW-Authenticate challenge.
+	Realm string
+	// Validate validates the token.
+	Validate TokenValidator
+}
+
+// BearerAuth returns a middleware that requires a bearer token
+// in the Authorization header.
+// Unauthenticated requests are answered with 401 Unauthorized.
+func BearerAuth(opts BearerAuthOptions) Middleware {
+	challenge := `Bearer realm="` + opts.Realm + `"`
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				unauthorized(w, challenge)
+				return
+			}
+
+			p, err := opts.Validate(r.Context(), strings.TrimSpace(token))
+			if err != nil || p == nil {
+				unauthorized(w, challenge+`, error="invalid_token"`)
+				return
+			}
+			if p.Scheme == "" {
+				p.Scheme = "Bearer"
+			}
+
+			next.ServeHTTP(w, WithPrincipal(r, p))
+		})
+	}
+}
+
+// StaticTokens returns a TokenValidator for a static map of tokens and subjects.
+// Tokens are compared in constant time.
+func StaticTokens(tokens map[string]string) TokenValidator {
+	return func(ctx context.Context, token string) (*Principal, error) {
+		var subject string
+		found := false
+		for t, s := range tokens {
+			if secureCompare(t, token) {
+				subject, found = s, true
+			}
+		}
+		if !found {
+			return nil, ErrUnauthenticated
+		}
+		return &Principal{Subject: subject}, nil
+	}
+}
+
+// secureCompare compares two strings in constant time.
+// Hashing first hides the length of the strings.
+func secureCompare(a, b string) bool {
+	ha := sha256.Sum256([]byte(a))
+	hb := sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
+}
+
+// unauthorized answers with 401 Unauthorized and the given challenge.
+func unauthorized(w http.ResponseWriter, challenge string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,159 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_BasicAuth(t *testing.T) {
+	testCases := map[string]struct {
+		username      string
+		password      string
+		noAuth        bool
+		expStatusCode int
+		expBody       string
+	}{
+		"ok": {
+			username:      "luke",
+			password:      "skywalker",
+			expStatusCode: http.StatusOK,
+			expBody:       "hello luke",
+		},
+		"wrong password": {
+			username:      "luke",
+			password:      "vader",
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"unknown user": {
+			username:      "leia",
+			password:      "skywalker",
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"no credentials": {
+			noAuth:        true,
+			expStatusCode: http.StatusUnauthorized,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			mux := muxify.NewMux()
+			mux.Use(muxify.BasicAuth(muxify.BasicAuthOptions{
+				Realm:    "muxify",
+				Validate: muxify.BasicUsers(map[string]string{"luke": "skywalker"}),
+			}))
+			mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("hello " + muxify.RequestPrincipal(r).Subject))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if !tc.noAuth {
+				req.SetBasicAuth(tc.username, tc.password)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if tc.expStatusCode == http.StatusUnauthorized {
+				want := `Basic realm="muxify", charset="UTF-8"`
+				if got := rec.Header().Get("WWW-Authenticate"); got != want {
+					t.Errorf("\nwant: %v\ngot: %v\n", want, got)
+				}
+				return
+			}
+			if got := rec.Body.String(); got != tc.expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBody, got)
+			}
+		})
+	}
+}
+
+func Test_BearerAuth_Subrouters(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Root", "MW1")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	api := mux.Subrouter().Prefix("/api")
+	api.Use(muxify.BearerAuth(muxify.BearerAuthOptions{
+		Validate: muxify.StaticTokens(map[string]string{"api-token": "service"}),
+	}))
+
+	admin := mux.Subrouter().Prefix("/admin")
+	admin.Use(muxify.BasicAuth(muxify.BasicAuthOptions{
+		Validate: muxify.BasicUsers(map[string]string{"admin": "secret"}),
+	}))
+
+	hello := func(w http.ResponseWriter, r *http.Request) {
+		p := muxify.RequestPrincipal(r)
+		_, _ = w.Write([]byte(p.Scheme + " " + p.Subject))
+	}
+	api.HandleFunc("GET /users", hello)
+	admin.HandleFunc("GET /users", hello)
+
+	testCases := map[string]struct {
+		path          string
+		bearer        string
+		basic         bool
+		expStatusCode int
+		expBody       string
+	}{
+		"ok - api with token": {
+			path:          "/api/users",
+			bearer:        "api-token",
+			expStatusCode: http.StatusOK,
+			expBody:       "Bearer service",
+		},
+		"api with invalid token": {
+			path:          "/api/users",
+			bearer:        "nope",
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"api with basic auth": {
+			path:          "/api/users",
+			basic:         true,
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"ok - admin with basic auth": {
+			path:          "/admin/users",
+			basic:         true,
+			expStatusCode: http.StatusOK,
+			expBody:       "Basic admin",
+		},
+		"admin with token": {
+			path:          "/admin/users",
+			bearer:        "api-token",
+			expStatusCode: http.StatusUnauthorized,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.bearer)
+			}
+			if tc.basic {
+				req.SetBasicAuth("admin", "secret")
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if tc.expBody != "" && rec.Body.String() != tc.expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBody, rec.Body.String())
+			}
+			if got := rec.Header().Get("X-Root"); got != "MW1" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "MW1", got)
+			}
+		})
+	}
+}
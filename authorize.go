@@ -0,0 +1,66 @@
+package muxify
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// AuthorizeOptions configures the Authorize middleware.
+type AuthorizeOptions struct {
+	// Check reports whether the principal meets a requirement.
+	// Defaults to HasRequirement.
+	Check func(p *Principal, requirement string) bool
+}
+
+// Authorize returns a middleware that enforces the requirements
+// declared with Route.Require on the matched route.
+// It must be used after an authentication middleware.
+// Requests without a principal are answered with 401 Unauthorized,
+// requests whose principal misses a requirement with 403 Forbidden.
+func Authorize(opts AuthorizeOptions) Middleware {
+	if opts.Check == nil {
+		opts.Check = HasRequirement
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var requirements []string
+			if route := CurrentRoute(r); route != nil {
+				requirements = route.required()
+			}
+			if len(requirements) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p := RequestPrincipal(r)
+			if p == nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			for _, requirement := range requirements {
+				if !opts.Check(p, requirement) {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HasRequirement reports whether the principal meets a requirement.
+// A requirement "scope:<name>" is met if the principal has the scope,
+// "role:<name>" if it has the role. Other requirements are never met.
+func HasRequirement(p *Principal, requirement string) bool {
+	kind, name, _ := strings.Cut(requirement, ":")
+	switch kind {
+	case "scope":
+		return slices.Contains(p.Scopes, name)
+	case "role":
+		return slices.Contains(p.Roles, name)
+	}
+	return false
+}
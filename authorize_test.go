@@ -0,0 +1,142 @@
+package muxify_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_Authorize(t *testing.T) {
+	principals := map[string]*muxify.Principal{
+		"reader": {Subject: "reader", Scopes: []string{"users.read"}},
+		"writer": {Subject: "writer", Scopes: []string{"users.read", "users.write"}},
+		"admin":  {Subject: "admin", Roles: []string{"admin"}},
+	}
+
+	mux := muxify.NewMux()
+	mux.HandleFunc("GET /public", func(w http.ResponseWriter, r *http.Request) {})
+
+	api := mux.Subrouter().Prefix("/api")
+	api.Use(
+		muxify.BearerAuth(muxify.BearerAuthOptions{
+			Validate: func(ctx context.Context, token string) (*muxify.Principal, error) {
+				if p, ok := principals[token]; ok {
+					return p, nil
+				}
+				return nil, muxify.ErrUnauthenticated
+			},
+		}),
+		muxify.Authorize(muxify.AuthorizeOptions{}),
+	)
+	api.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {}).Require("scope:users.read")
+	api.HandleFunc("POST /users", func(w http.ResponseWriter, r *http.Request) {}).Require("scope:users.read", "scope:users.write")
+	api.HandleFunc("DELETE /users", func(w http.ResponseWriter, r *http.Request) {}).Require("role:admin")
+	api.HandleFunc("GET /me", func(w http.ResponseWriter, r *http.Request) {})
+
+	testCases := map[string]struct {
+		method        string
+		path          string
+		token         string
+		expStatusCode int
+	}{
+		"ok - public": {
+			method:        http.MethodGet,
+			path:          "/public",
+			expStatusCode: http.StatusOK,
+		},
+		"ok - no requirements": {
+			method:        http.MethodGet,
+			path:          "/api/me",
+			token:         "reader",
+			expStatusCode: http.StatusOK,
+		},
+		"ok - scope": {
+			method:        http.MethodGet,
+			path:          "/api/users",
+			token:         "reader",
+			expStatusCode: http.StatusOK,
+		},
+		"ok - multiple scopes": {
+			method:        http.MethodPost,
+			path:          "/api/users",
+			token:         "writer",
+			expStatusCode: http.StatusOK,
+		},
+		"ok - role": {
+			method:        http.MethodDelete,
+			path:          "/api/users",
+			token:         "admin",
+			expStatusCode: http.StatusOK,
+		},
+		"missing scope": {
+			method:        http.MethodPost,
+			path:          "/api/users",
+			token:         "reader",
+			expStatusCode: http.StatusForbidden,
+		},
+		"missing role": {
+			method:        http.MethodDelete,
+			path:          "/api/users",
+			token:         "writer",
+			expStatusCode: http.StatusForbidden,
+		},
+		"unauthenticated": {
+			method:        http.MethodGet,
+			path:          "/api/users",
+			expStatusCode: http.StatusUnauthorized,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+		})
+	}
+}
+
+func Test_Authorize_NoPrincipal(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.Authorize(muxify.AuthorizeOptions{}))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {}).Require("scope:users.read")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func Test_Routes(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {})
+	mux.Subrouter().Prefix("/admin").
+		HandleFunc("DELETE /users/{id}", func(w http.ResponseWriter, r *http.Request) {}).
+		Require("role:admin", "scope:users.write")
+
+	expRoutes := []string{
+		"GET /",
+		"DELETE /admin/users/{id} [role:admin scope:users.write]",
+	}
+
+	routes := mux.Routes()
+	if len(routes) != len(expRoutes) {
+		t.Fatalf("\nwant: %v\ngot: %v\n", len(expRoutes), len(routes))
+	}
+	for i, route := range routes {
+		if got := route.String(); got != expRoutes[i] {
+			t.Errorf("\nwant: %v\ngot: %v\n", expRoutes[i], got)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package muxify
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails all requests fast.
+	BreakerOpen
+	// BreakerHalfOpen lets probe requests through to test the route.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerOptions configures the Breaker middleware.
+type BreakerOptions struct {
+	// ConsecutiveFailures trips the breaker after this many failures in a row.
+	// Defaults to 5.
+	ConsecutiveFailures int
+	// FailureRate trips the breaker if the rate of failures within Window
+	// reaches it (e.g. 0.5). Zero disables it.
+	FailureRate float64
+	// MinRequests is the number of requests within Window
+	// before FailureRate is considered. Defaults to 10.
+	MinRequests int
+	// Window is the interval failures are counted in for FailureRate.
+	// Defaults to 10 seconds.
+	Window time.Duration
+	// OpenTimeout is the time the breaker stays open before it lets probes through.
+	// Defaults to 30 seconds.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of successful probes that close the breaker again.
+	// Defaults to 1.
+	HalfOpenProbes int
+	// IsFailure reports whether a response status is a failure.
+	// Defaults to status codes >= 500.
+	IsFailure func(status int) bool
+	// OnStateChange is called when the breaker of a registered pattern changes its state.
+	OnStateChange func(pattern string, from, to BreakerState)
+	// OpenHandler is called for requests failed fast by an open breaker.
+	// Defaults to a plain 503 Service Unavailable response.
+	OpenHandler http.Handler
+}
+
+// Breaker returns a circuit breaker middleware with one breaker per
+// registered pattern. An open breaker answers with 503 Service Unavailable
+// and a Retry-After header until it lets probes through again.
+// The state of a breaker is shown in the route listing.
+func Breaker(opts BreakerOptions) Middleware {
+	if opts.ConsecutiveFailures <= 0 {
+		opts.ConsecutiveFailures = 5
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 10
+	}
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Second
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 30 * time.Second
+	}
+	if opts.HalfOpenProbes <= 0 {
+		opts.HalfOpenProbes = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = func(status int) bool { return status >= http.StatusInternalServerError }
+	}
+	if opts.OpenHandler == nil {
+		opts.OpenHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		})
+	}
+
+	set := &breakerSet{opts: &opts, breakers: make(map[string]*breaker)}
+	return func(next http.Handler) http.Handler {
+		return &breakerHandler{set: set, next: next}
+	}
+}
+
+// breakerSet holds the breakers of a Breaker middleware by registered pattern.
+type breakerSet struct {
+	opts *BreakerOptions
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// get returns the breaker of the pattern, which is created on first use.
+func (set *breakerSet) get(pattern string) *breaker {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	b, ok := set.breakers[pattern]
+	if !ok {
+		b = &breaker{opts: set.opts, pattern: pattern}
+		set.breakers[pattern] = b
+	}
+	return b
+}
+
+// breakerHandler is the http.Handler of a Breaker middleware.
+type breakerHandler struct {
+	set  *breakerSet
+	next http.Handler
+}
+
+// registerRoute shows the breaker of the route in the route listing
+// before the first request. A route that replaces another one with
+// the same pattern shares its breaker.
+func (h *breakerHandler) registerRoute(route *Route) {
+	b := h.set.get(route.pattern)
+	route.Annotate("breaker", func() string { return b.currentState().String() })
+}
+
+func (h *breakerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	opts := h.set.opts
+	b := h.set.get(RoutePattern(r))
+
+	allowed, retryAfter := b.allow(time.Now())
+	if !allowed {
+		w.Header().Set("Retry-After", seconds(retryAfter))
+		opts.OpenHandler.ServeHTTP(w, r)
+		return
+	}
+
+	rw := WrapResponseWriter(w)
+	defer func() {
+		if p := recover(); p != nil {
+			b.record(true, time.Now())
+			panic(p)
+		}
+		status := rw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		b.record(opts.IsFailure(status), time.Now())
+	}()
+
+	h.next.ServeHTTP(rw, r)
+}
+
+// breaker is the circuit breaker of a registered pattern.
+type breaker struct {
+	opts    *BreakerOptions
+	pattern string
+
+	mu          sync.Mutex
+	state       BreakerState
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+	// changes are the state changes to notify after unlocking.
+	changes []stateChange
+}
+
+// stateChange is a state change of a breaker.
+type stateChange struct {
+	from, to BreakerState
+}
+
+// allow reports whether a request may pass and otherwise
+// how long the breaker stays open.
+func (b *breaker) allow(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.notify()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if wait := b.openedAt.Add(b.opts.OpenTimeout).Sub(now); wait > 0 {
+			return false, wait
+		}
+		b.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.opts.HalfOpenProbes {
+			return false, b.opts.OpenTimeout
+		}
+		b.probes++
+	}
+
+	return true, 0
+}
+
+// record records the outcome of a request.
+func (b *breaker) record(failure bool, now time.Time) {
+	b.mu.Lock()
+	defer b.notify()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerHalfOpen {
+		if failure {
+			b.open(now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.opts.HalfOpenProbes {
+			b.setState(BreakerClosed)
+		}
+		return
+	}
+	if b.state == BreakerOpen {
+		return
+	}
+
+	if now.Sub(b.windowStart) > b.opts.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+	if !failure {
+		b.consecutive = 0
+		return
+	}
+	b.failures++
+	b.consecutive++
+
+	if b.consecutive >= b.opts.ConsecutiveFailures ||
+		b.opts.FailureRate > 0 && b.requests >= b.opts.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.opts.FailureRate {
+		b.open(now)
+	}
+}
+
+// open trips the breaker.
+func (b *breaker) open(now time.Time) {
+	b.openedAt = now
+	b.setState(BreakerOpen)
+}
+
+// setState changes the state and resets the counters.
+// The change is notified by notify.
+func (b *breaker) setState(state BreakerState) {
+	from := b.state
+	b.state = state
+	b.consecutive, b.requests, b.failures, b.probes, b.successes = 0, 0, 0, 0, 0
+	b.windowStart = time.Time{}
+	if from != state && b.opts.OnStateChange != nil {
+		b.changes = append(b.changes, stateChange{from: from, to: state})
+	}
+}
+
+// notify calls OnStateChange for the pending state changes. It must be
+// called without holding the lock, so the callback can read the state.
+func (b *breaker) notify() {
+	b.mu.Lock()
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	for _, c := range changes {
+		b.opts.OnStateChange(b.pattern, c.from, c.to)
+	}
+}
+
+// currentState returns the state of the breaker.
+func (b *breaker) currentState() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
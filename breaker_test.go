@@ -0,0 +1,149 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_Breaker(t *testing.T) {
+	var mu sync.Mutex
+	var changes []string
+	var fail bool
+
+	mux := muxify.NewMux()
+	gateway := mux.Subrouter().Prefix("/gateway")
+	gateway.Use(muxify.Breaker(muxify.BreakerOptions{
+		ConsecutiveFailures: 2,
+		OpenTimeout:         20 * time.Millisecond,
+		OnStateChange: func(pattern string, from, to muxify.BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, pattern+": "+from.String()+" -> "+to.String())
+		},
+	}))
+	gateway.HandleFunc("GET /flaky", func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+	gateway.HandleFunc("GET /stable", func(w http.ResponseWriter, r *http.Request) {})
+
+	steps := []struct {
+		path          string
+		fail          bool
+		wait          time.Duration
+		expStatusCode int
+	}{
+		{path: "/gateway/flaky", expStatusCode: http.StatusOK},
+		{path: "/gateway/flaky", fail: true, expStatusCode: http.StatusBadGateway},
+		{path: "/gateway/flaky", fail: true, expStatusCode: http.StatusBadGateway},
+		// open
+		{path: "/gateway/flaky", expStatusCode: http.StatusServiceUnavailable},
+		{path: "/gateway/stable", expStatusCode: http.StatusOK},
+		// half-open probe fails
+		{path: "/gateway/flaky", fail: true, wait: 30 * time.Millisecond, expStatusCode: http.StatusBadGateway},
+		{path: "/gateway/flaky", expStatusCode: http.StatusServiceUnavailable},
+		// half-open probe succeeds
+		{path: "/gateway/flaky", wait: 30 * time.Millisecond, expStatusCode: http.StatusOK},
+		{path: "/gateway/flaky", expStatusCode: http.StatusOK},
+	}
+	for i, step := range steps {
+		time.Sleep(step.wait)
+		fail = step.fail
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, step.path, nil))
+
+		if rec.Code != step.expStatusCode {
+			t.Errorf("step %d\nwant: %v\ngot: %v\n", i, step.expStatusCode, rec.Code)
+		}
+		if rec.Code == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("step %d: Retry-After header missing", i)
+		}
+	}
+
+	expChanges := []string{
+		"GET /gateway/flaky: closed -> open",
+		"GET /gateway/flaky: open -> half-open",
+		"GET /gateway/flaky: half-open -> open",
+		"GET /gateway/flaky: open -> half-open",
+		"GET /gateway/flaky: half-open -> closed",
+	}
+	if strings.Join(changes, "\n") != strings.Join(expChanges, "\n") {
+		t.Errorf("\nwant: %v\ngot: %v\n", expChanges, changes)
+	}
+}
+
+func Test_Breaker_FailureRate(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.Breaker(muxify.BreakerOptions{
+		ConsecutiveFailures: 100,
+		FailureRate:         0.5,
+		MinRequests:         4,
+	}))
+	count := 0
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count%2 == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	for i := 0; i < 4; i++ {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	want := "GET / breaker=open"
+	if got := mux.Routes()[0].String(); got != want {
+		t.Errorf("\nwant: %v\ngot: %v\n", want, got)
+	}
+}
+
+func Test_Breaker_Listing(t *testing.T) {
+	var listing []string
+	mux := muxify.NewMux()
+	mux.UseNamed("breaker", muxify.Breaker(muxify.BreakerOptions{
+		ConsecutiveFailures: 1,
+		OnStateChange: func(pattern string, from, to muxify.BreakerState) {
+			// reading the state from the callback must not deadlock
+			for _, route := range mux.Routes() {
+				listing = append(listing, route.String())
+			}
+		},
+	}))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	// shown before the first request
+	if got, want := mux.Routes()[0].String(), "GET / breaker=closed"; got != want {
+		t.Errorf("\nwant: %v\ngot: %v\n", want, got)
+	}
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got, want := strings.Join(listing, ","), "GET / breaker=open"; got != want {
+		t.Errorf("\nwant: %v\ngot: %v\n", want, got)
+	}
+
+	// a replaced route keeps the breaker of its pattern
+	mux.Update(func(mux *muxify.Mux) {
+		mux.Remove(mux.Routes()...)
+		mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	if got, want := mux.Routes()[0].String(), "GET / breaker=open"; got != want {
+		t.Errorf("\nwant: %v\ngot: %v\n", want, got)
+	}
+}
@@ -0,0 +1,413 @@
+package muxify
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultResponseCacheMaxBytes is the default size limit of a ResponseCache.
+const DefaultResponseCacheMaxBytes = 32 << 20
+
+// DefaultResponseCacheMaxEntryBytes is the default size limit of a cached response.
+const DefaultResponseCacheMaxEntryBytes = 1 << 20
+
+// ResponseCacheOptions configures a ResponseCache.
+type ResponseCacheOptions struct {
+	// MaxBytes limits the total size of the cached bodies.
+	// The least recently used responses are evicted first.
+	// Defaults to DefaultResponseCacheMaxBytes.
+	MaxBytes int64
+	// MaxEntryBytes limits the size of a cached body. Larger responses are not cached.
+	// Defaults to DefaultResponseCacheMaxEntryBytes.
+	MaxEntryBytes int64
+	// TTL is the freshness lifetime of responses without a max-age or s-maxage
+	// Cache-Control directive. Zero only caches responses with one.
+	TTL time.Duration
+	// StaleWhileRevalidate is how long a stale response is still served
+	// while it is revalidated in the background.
+	StaleWhileRevalidate time.Duration
+}
+
+// ResponseCache is an in-memory cache of GET responses.
+// Responses are keyed by host, path and query and the request headers
+// named in their Vary header.
+type ResponseCache struct {
+	opts ResponseCacheOptions
+
+	mu      sync.Mutex
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+	vary    map[string]*varyIndex
+}
+
+// cacheEntry is a cached response.
+// The status, header and body are never modified once stored.
+type cacheEntry struct {
+	key          string
+	base         string
+	status       int
+	header       http.Header
+	body         []byte
+	stored       time.Time
+	expires      time.Time
+	revalidating bool
+}
+
+// varyIndex holds the Vary header names of the responses of a URL
+// and the number of cached variants.
+type varyIndex struct {
+	names    []string
+	variants int
+}
+
+// NewResponseCache returns a new ResponseCache.
+func NewResponseCache(opts ResponseCacheOptions) *ResponseCache {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultResponseCacheMaxBytes
+	}
+	if opts.MaxEntryBytes <= 0 {
+		opts.MaxEntryBytes = DefaultResponseCacheMaxEntryBytes
+	}
+	opts.MaxEntryBytes = min(opts.MaxEntryBytes, opts.MaxBytes)
+
+	return &ResponseCache{
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		vary:    make(map[string]*varyIndex),
+	}
+}
+
+// Middleware returns a middleware that serves GET requests from the cache
+// and caches successful responses that allow it. Requests with an
+// Authorization header are never cached. The Cache-Status header
+// tells whether a response was served from the cache.
+func (c *ResponseCache) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet || r.Header.Get("Authorization") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			directives := parseCacheControl(r.Header.Get("Cache-Control"))
+			if _, ok := directives["no-store"]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			base := r.Host + r.URL.RequestURI()
+			now := time.Now()
+			status := "muxify; fwd=request"
+			if _, ok := directives["no-cache"]; !ok {
+				e, stale, revalidate := c.lookup(r, base, now)
+				if e != nil {
+					if stale {
+						e.serve(w, r, now, "muxify; hit; fwd=stale")
+					} else {
+						e.serve(w, r, now, "muxify; hit")
+					}
+					if revalidate {
+						go c.revalidate(next, r, base, e)
+					}
+					return
+				}
+				status = "muxify; fwd=miss"
+			}
+
+			w.Header().Set("Cache-Status", status)
+			cw := newCacheWriter(w, c.opts.MaxEntryBytes)
+			next.ServeHTTP(cw, r)
+			c.store(r, base, cw, now)
+		})
+	}
+}
+
+// lookup returns the cached response of the request if it is fresh
+// or within the stale-while-revalidate window. It reports whether the
+// response is stale and whether the caller has to revalidate it.
+func (c *ResponseCache) lookup(r *http.Request, base string, now time.Time) (e *cacheEntry, stale, revalidate bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	idx, ok := c.vary[base]
+	if !ok {
+		return nil, false, false
+	}
+	el, ok := c.entries[variantKey(base, idx.names, r)]
+	if !ok {
+		return nil, false, false
+	}
+	e = el.Value.(*cacheEntry)
+
+	switch {
+	case now.Before(e.expires):
+	case now.Before(e.expires.Add(c.opts.StaleWhileRevalidate)):
+		stale = true
+		revalidate = !e.revalidating
+		e.revalidating = true
+	default:
+		return nil, false, false
+	}
+
+	c.lru.MoveToFront(el)
+	return e, stale, revalidate
+}
+
+// revalidate refreshes a stale response in the background.
+// A panicking handler is dropped, there is no server to recover it.
+func (c *ResponseCache) revalidate(next http.Handler, r *http.Request, base string, e *cacheEntry) {
+	stored := false
+	defer func() {
+		_ = recover()
+		if !stored {
+			// let a later request try again
+			c.mu.Lock()
+			e.revalidating = false
+			c.mu.Unlock()
+		}
+	}()
+
+	r = r.Clone(context.WithoutCancel(r.Context()))
+	r.Body = http.NoBody
+	cw := newCacheWriter(&discardWriter{header: make(http.Header)}, c.opts.MaxEntryBytes)
+
+	now := time.Now()
+	next.ServeHTTP(cw, r)
+	stored = c.store(r, base, cw, now)
+}
+
+// store caches the captured response if it allows it and reports whether it did.
+func (c *ResponseCache) store(r *http.Request, base string, cw *cacheWriter, now time.Time) bool {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.status != http.StatusOK || cw.skip {
+		return false
+	}
+
+	// the policy of the whole response applies
+	h := cw.response
+	directives := parseCacheControl(h.Get("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[d]; ok {
+			return false
+		}
+	}
+	if len(h.Values("Set-Cookie")) > 0 {
+		return false
+	}
+
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return false
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	ttl := c.opts.TTL
+	if v, ok := directives["s-maxage"]; ok {
+		ttl = parseSeconds(v)
+	} else if v, ok := directives["max-age"]; ok {
+		ttl = parseSeconds(v)
+	}
+	if ttl <= 0 {
+		return false
+	}
+
+	h = cw.header.Clone()
+	h.Del("Cache-Status")
+	h.Del("Age")
+	e := &cacheEntry{
+		key:     variantKey(base, names, r),
+		base:    base,
+		status:  cw.status,
+		header:  h,
+		body:    bytes.Clone(cw.body.Bytes()),
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	idx, ok := c.vary[base]
+	if !ok {
+		idx = &varyIndex{}
+		c.vary[base] = idx
+	}
+	// variants cached with other Vary names can't be found anymore
+	// and are left to the eviction
+	idx.names = names
+	idx.variants++
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += int64(len(e.body))
+
+	for c.size > c.opts.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+	return true
+}
+
+// remove removes a cached response. It must be called with the lock held.
+func (c *ResponseCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.body))
+
+	if idx, ok := c.vary[e.base]; ok {
+		idx.variants--
+		if idx.variants == 0 {
+			delete(c.vary, e.base)
+		}
+	}
+}
+
+// serve writes the cached response.
+// Conditional requests are answered with 304 Not Modified.
+func (e *cacheEntry) serve(w http.ResponseWriter, r *http.Request, now time.Time, status string) {
+	h := w.Header()
+	for k, v := range e.header {
+		h[k] = slices.Clone(v)
+	}
+	h.Set("Age", strconv.Itoa(int(now.Sub(e.stored).Seconds())))
+	h.Set("Cache-Status", status)
+
+	if notModified(r, h) {
+		writeNotModified(w)
+		return
+	}
+	w.WriteHeader(e.status)
+	_, _ = w.Write(e.body)
+}
+
+// variantKey returns the cache key of the request for the Vary header names.
+func variantKey(base string, names []string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range names {
+		b.WriteByte(0)
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// parseCacheControl parses the directives of a Cache-Control header.
+func parseCacheControl(v string) map[string]string {
+	directives := make(map[string]string)
+	for _, d := range strings.Split(v, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+// parseSeconds parses a delta-seconds value.
+// Invalid values result in zero.
+func parseSeconds(v string) time.Duration {
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// cacheWriter passes a response through and captures it
+// for the cache or the Idempotency middleware.
+type cacheWriter struct {
+	http.ResponseWriter
+	limit int64
+	// before are the headers outer middlewares set for this request only,
+	// e.g. a traceparent, which are not captured.
+	before http.Header
+	status int
+	// response are all headers of the response,
+	// header those the handler added or changed.
+	response http.Header
+	header   http.Header
+	body     bytes.Buffer
+	skip     bool
+}
+
+// newCacheWriter returns a cacheWriter capturing responses up to limit bytes.
+func newCacheWriter(w http.ResponseWriter, limit int64) *cacheWriter {
+	return &cacheWriter{ResponseWriter: w, limit: limit, before: w.Header().Clone()}
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.status == 0 {
+		cw.status = code
+		cw.response = cw.Header().Clone()
+		cw.header = make(http.Header)
+		for k, v := range cw.Header() {
+			if !slices.Equal(v, cw.before[k]) {
+				cw.header[k] = slices.Clone(v)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.skip {
+		if int64(cw.body.Len()+len(p)) > cw.limit {
+			cw.skip = true
+			cw.body = bytes.Buffer{}
+		} else {
+			cw.body.Write(p)
+		}
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush implements the http.Flusher interface.
+// Flushed responses are streams and not captured.
+func (cw *cacheWriter) Flush() {
+	cw.skip = true
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// discardWriter is an http.ResponseWriter that discards the response.
+type discardWriter struct {
+	header http.Header
+}
+
+func (dw *discardWriter) Header() http.Header {
+	return dw.header
+}
+
+func (dw *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (dw *discardWriter) WriteHeader(int) {}
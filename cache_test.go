@@ -0,0 +1,309 @@
+package muxify_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_ResponseCache(t *testing.T) {
+	var calls atomic.Int64
+	handler := func(cacheControl string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			n := calls.Add(1)
+			if cacheControl != "" {
+				w.Header().Set("Cache-Control", cacheControl)
+			}
+			fmt.Fprintf(w, "%s %d", r.Header.Get("Accept-Language"), n)
+		}
+	}
+
+	cache := muxify.NewResponseCache(muxify.ResponseCacheOptions{})
+	mux := muxify.NewMux()
+	mux.Use(cache.Middleware())
+	mux.HandleFunc("GET /cached", handler("max-age=60"))
+	mux.HandleFunc("GET /private", handler("private, max-age=60"))
+	mux.HandleFunc("GET /default", handler(""))
+	mux.HandleFunc("GET /vary", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Accept-Language")
+		handler("max-age=60")(w, r)
+	})
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	testCases := map[string]struct {
+		path           string
+		header         map[string]string
+		expCached      bool
+		expCacheStatus string
+	}{
+		"cached": {
+			path:           "/cached",
+			expCached:      true,
+			expCacheStatus: "muxify; hit",
+		},
+		"request no-cache": {
+			path:           "/cached",
+			header:         map[string]string{"Cache-Control": "no-cache"},
+			expCacheStatus: "muxify; fwd=request",
+		},
+		"authorization": {
+			path:   "/cached",
+			header: map[string]string{"Authorization": "Bearer token"},
+		},
+		"private": {
+			path:           "/private",
+			expCacheStatus: "muxify; fwd=miss",
+		},
+		"no ttl": {
+			path:           "/default",
+			expCacheStatus: "muxify; fwd=miss",
+		},
+		"vary": {
+			path:           "/vary",
+			header:         map[string]string{"Accept-Language": "de"},
+			expCached:      true,
+			expCacheStatus: "muxify; hit",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			first := get(tc.path, tc.header)
+			second := get(tc.path, tc.header)
+
+			if cached := first.Body.String() == second.Body.String(); cached != tc.expCached {
+				t.Errorf("\nwant: %v\ngot: %v (%q, %q)\n", tc.expCached, cached, first.Body.String(), second.Body.String())
+			}
+			if got := second.Header().Get("Cache-Status"); got != tc.expCacheStatus {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expCacheStatus, got)
+			}
+		})
+	}
+
+	t.Run("vary variants", func(t *testing.T) {
+		de := get("/vary", map[string]string{"Accept-Language": "de"})
+		en := get("/vary", map[string]string{"Accept-Language": "en"})
+
+		if !strings.HasPrefix(de.Body.String(), "de ") || !strings.HasPrefix(en.Body.String(), "en ") {
+			t.Errorf("\nwant: a variant per language\ngot: %q, %q\n", de.Body.String(), en.Body.String())
+		}
+	})
+}
+
+func Test_ResponseCache_ETag(t *testing.T) {
+	cache := muxify.NewResponseCache(muxify.ResponseCacheOptions{TTL: time.Minute})
+	mux := muxify.NewMux()
+	mux.Use(cache.Middleware(), muxify.ETag(muxify.ETagOptions{}))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusNotModified, rec.Code)
+	}
+	if got := rec.Header().Get("Cache-Status"); got != "muxify; hit" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "muxify; hit", got)
+	}
+}
+
+func Test_ResponseCache_MaxBytes(t *testing.T) {
+	var calls atomic.Int64
+	cache := muxify.NewResponseCache(muxify.ResponseCacheOptions{
+		MaxBytes:      10,
+		MaxEntryBytes: 6,
+		TTL:           time.Minute,
+	})
+	mux := muxify.NewMux()
+	mux.Use(cache.Middleware())
+	mux.HandleFunc("GET /{size}", func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var size int
+		fmt.Sscan(r.PathValue("size"), &size)
+		_, _ = w.Write([]byte(strings.Repeat("x", size)))
+	})
+
+	get := func(path string) {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// too large for an entry
+	get("/7")
+	get("/7")
+	if calls.Load() != 2 {
+		t.Errorf("\nwant: %v\ngot: %v\n", 2, calls.Load())
+	}
+
+	// the second response evicts the first one
+	calls.Store(0)
+	get("/5")
+	get("/6")
+	get("/6")
+	get("/5")
+	if calls.Load() != 3 {
+		t.Errorf("\nwant: %v\ngot: %v\n", 3, calls.Load())
+	}
+}
+
+func Test_ResponseCache_StaleWhileRevalidate(t *testing.T) {
+	var calls atomic.Int64
+	revalidated := make(chan struct{}, 1)
+	cache := muxify.NewResponseCache(muxify.ResponseCacheOptions{
+		StaleWhileRevalidate: time.Minute,
+	})
+	mux := muxify.NewMux()
+	mux.Use(cache.Middleware())
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=1")
+		fmt.Fprint(w, n)
+		if n > 1 {
+			revalidated <- struct{}{}
+		}
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	get()
+	time.Sleep(1100 * time.Millisecond)
+
+	rec := get()
+	if rec.Body.String() != "1" || rec.Header().Get("Cache-Status") != "muxify; hit; fwd=stale" {
+		t.Fatalf("\nwant: stale response\ngot: %q %q\n", rec.Body.String(), rec.Header().Get("Cache-Status"))
+	}
+
+	select {
+	case <-revalidated:
+	case <-time.After(time.Second):
+		t.Fatal("response not revalidated")
+	}
+
+	// the refreshed response is stored right after the handler returned
+	deadline := time.Now().Add(time.Second)
+	for get().Body.String() != "2" {
+		if time.Now().After(deadline) {
+			t.Fatal("refreshed response not served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_ResponseCache_RevalidatePanic(t *testing.T) {
+	var calls atomic.Int64
+	revalidated := make(chan int64, 2)
+	cache := muxify.NewResponseCache(muxify.ResponseCacheOptions{
+		StaleWhileRevalidate: time.Minute,
+	})
+	mux := muxify.NewMux()
+	mux.Use(cache.Middleware())
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if n > 1 {
+			defer func() { revalidated <- n }()
+		}
+		if n == 2 {
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set("Cache-Control", "max-age=1")
+		fmt.Fprint(w, n)
+	})
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	get()
+	time.Sleep(1100 * time.Millisecond)
+
+	// the first revalidation panics, the next stale hit tries again
+	for want := int64(2); want <= 3; want++ {
+		deadline := time.Now().Add(time.Second)
+		for {
+			get()
+			select {
+			case n := <-revalidated:
+				if n != want {
+					t.Fatalf("\nwant: %v\ngot: %v\n", want, n)
+				}
+			case <-time.After(10 * time.Millisecond):
+				if time.Now().After(deadline) {
+					t.Fatal("response not revalidated")
+				}
+				continue
+			}
+			break
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for get().Body.String() != "3" {
+		if time.Now().After(deadline) {
+			t.Fatal("refreshed response not served")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_ResponseCache_RequestHeaders(t *testing.T) {
+	var requests atomic.Int64
+	requestID := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-Id", fmt.Sprint(requests.Add(1)))
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	cache := muxify.NewResponseCache(muxify.ResponseCacheOptions{})
+	mux := muxify.NewMux()
+	mux.Use(requestID, cache.Middleware())
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("X-Handler", "true")
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	for i := 1; i <= 2; i++ {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		// headers of outer middlewares are not replayed from the cache
+		if got, want := rec.Header().Get("X-Request-Id"), fmt.Sprint(i); got != want {
+			t.Errorf("\nwant: %v\ngot: %v\n", want, got)
+		}
+		if got := rec.Header().Get("X-Handler"); got != "true" {
+			t.Errorf("\nwant: %v\ngot: %v\n", "true", got)
+		}
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get("Cache-Status"); got != "muxify; hit" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "muxify; hit", got)
+	}
+}
@@ -0,0 +1,391 @@
+package muxify
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultCompressMinSize is the minimum response size in bytes
+// the Compress middleware compresses when no other size is given.
+const DefaultCompressMinSize = 1024
+
+// Encoder is a content coding the Compress middleware can apply to a response.
+type Encoder interface {
+	// Encoding returns the content coding token, e.g. "gzip" or "br".
+	Encoding() string
+	// NewWriter returns a writer that compresses to w.
+	// Writers that implement Reset(io.Writer) are pooled and reused.
+	NewWriter(w io.Writer) io.WriteCloser
+}
+
+// NewGzipEncoder returns a gzip Encoder with the given compression level.
+// It panics if the level is invalid.
+func NewGzipEncoder(level int) Encoder {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		panic("muxify: " + err.Error())
+	}
+	return gzipEncoder{level: level}
+}
+
+// NewDeflateEncoder returns a deflate Encoder with the given compression level.
+// It panics if the level is invalid.
+func NewDeflateEncoder(level int) Encoder {
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		panic("muxify: " + err.Error())
+	}
+	return deflateEncoder{level: level}
+}
+
+type gzipEncoder struct{ level int }
+
+func (e gzipEncoder) Encoding() string { return "gzip" }
+
+func (e gzipEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	zw, _ := gzip.NewWriterLevel(w, e.level)
+	return zw
+}
+
+type deflateEncoder struct{ level int }
+
+func (e deflateEncoder) Encoding() string { return "deflate" }
+
+func (e deflateEncoder) NewWriter(w io.Writer) io.WriteCloser {
+	zw, _ := flate.NewWriter(w, e.level)
+	return zw
+}
+
+// CompressOptions configures the Compress middleware.
+type CompressOptions struct {
+	// MinSize is the minimum response size in bytes that gets compressed.
+	// Defaults to DefaultCompressMinSize.
+	MinSize int
+	// Encoders are additional encoders (e.g. br or zstd) in order of preference.
+	// They are preferred over the built-in gzip and deflate encoders
+	// and replace a built-in encoder with the same encoding.
+	Encoders []Encoder
+	// SkipContentTypes are additional media types that are never compressed.
+	// An entry ending with a slash (e.g. "image/") matches a whole type.
+	SkipContentTypes []string
+}
+
+// defaultSkipContentTypes are media types that are already compressed.
+var defaultSkipContentTypes = []string{
+	"image/",
+	"audio/",
+	"video/",
+	"font/woff",
+	"font/woff2",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-brotli",
+	"application/octet-stream",
+	"application/pdf",
+}
+
+// compressor holds the configuration of a Compress middleware.
+type compressor struct {
+	minSize   int
+	encoders  []Encoder
+	pools     map[string]*sync.Pool
+	skipTypes []string
+}
+
+// Compress returns a middleware that compresses responses with the encoding
+// negotiated from the Accept-Encoding request header (q-values respected).
+// Responses smaller than MinSize, with an already compressed content type or
+// with a Content-Encoding set by the handler are sent as is. A strong ETag
+// of a compressed response is made weak.
+// The wrapped http.ResponseWriter keeps supporting http.Flusher, http.Hijacker
+// and http.ResponseController.
+func Compress(opts CompressOptions) Middleware {
+	c := &compressor{
+		minSize:   opts.MinSize,
+		pools:     make(map[string]*sync.Pool),
+		skipTypes: append(append([]string{}, defaultSkipContentTypes...), opts.SkipContentTypes...),
+	}
+	if c.minSize <= 0 {
+		c.minSize = DefaultCompressMinSize
+	}
+
+	encoders := append(append([]Encoder{}, opts.Encoders...),
+		NewGzipEncoder(gzip.DefaultCompression),
+		NewDeflateEncoder(flate.DefaultCompression),
+	)
+	for _, enc := range encoders {
+		token := strings.ToLower(enc.Encoding())
+		if _, ok := c.pools[token]; ok {
+			continue
+		}
+		c.encoders = append(c.encoders, enc)
+		c.pools[token] = &sync.Pool{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addVary(w.Header(), "Accept-Encoding")
+
+			enc := c.negotiate(r.Header.Get("Accept-Encoding"))
+			if enc == nil || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, c: c, enc: enc}
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// negotiate returns the encoder with the highest q-value in the
+// Accept-Encoding header or nil if there is none.
+// Ties are resolved by the order of the encoders.
+func (c *compressor) negotiate(acceptEncoding string) Encoder {
+	if acceptEncoding == "" {
+		return nil
+	}
+
+	accepted := parseAcceptEncoding(acceptEncoding)
+
+	var best Encoder
+	bestQ := 0.0
+	for _, enc := range c.encoders {
+		q, ok := accepted[strings.ToLower(enc.Encoding())]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+// parseAcceptEncoding parses an Accept-Encoding header value
+// into a map of content codings and their q-values.
+func parseAcceptEncoding(s string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(s, ",") {
+		token, params, _ := strings.Cut(part, ";")
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token == "" {
+			continue
+		}
+
+		q := 1.0
+		if name, value, ok := strings.Cut(params, "="); ok && strings.TrimSpace(name) == "q" {
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = v
+		}
+		accepted[token] = q
+	}
+
+	return accepted
+}
+
+// compressible reports whether responses of the given content type
+// should be compressed.
+func (c *compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+	for _, skip := range c.skipTypes {
+		if strings.HasSuffix(skip, "/") && strings.HasPrefix(mediaType, skip) || mediaType == skip {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resetter is implemented by writers that can be pooled.
+type resetter interface {
+	Reset(w io.Writer)
+}
+
+// getWriter returns a pooled or new writer of the encoder compressing to w.
+func (c *compressor) getWriter(enc Encoder, w io.Writer) io.WriteCloser {
+	if zw, ok := c.pools[strings.ToLower(enc.Encoding())].Get().(io.WriteCloser); ok {
+		zw.(resetter).Reset(w)
+		return zw
+	}
+	return enc.NewWriter(w)
+}
+
+// putWriter returns the writer to the pool of the encoder if it can be reused.
+func (c *compressor) putWriter(enc Encoder, zw io.WriteCloser) {
+	if _, ok := zw.(resetter); ok {
+		c.pools[strings.ToLower(enc.Encoding())].Put(zw)
+	}
+}
+
+// addVary adds the value to the Vary header unless it is already listed.
+func addVary(h http.Header, value string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", value)
+}
+
+// compressWriter buffers the beginning of a response until it knows
+// whether the response is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	enc      Encoder
+	code     int
+	buf      []byte
+	decided  bool
+	hijacked bool
+	zw       io.WriteCloser
+}
+
+// WriteHeader records the status code.
+// It is sent as soon as the response is known to be compressed or not.
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.code != 0 {
+		return
+	}
+	cw.code = code
+
+	h := cw.Header()
+	if !bodyAllowed(code) || h.Get("Content-Encoding") != "" {
+		cw.decide(false)
+		return
+	}
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < cw.c.minSize {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.c.minSize {
+			return len(p), nil
+		}
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.zw != nil {
+		return cw.zw.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide sends the header, starts compressing if requested and possible
+// and writes the buffered body.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+
+	h := cw.Header()
+	if _, ok := h["Content-Type"]; !ok && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	if compress &&
+		bodyAllowed(cw.code) &&
+		cw.code != http.StatusPartialContent &&
+		h.Get("Content-Encoding") == "" &&
+		cw.c.compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.enc.Encoding())
+		// the compressed body is not byte-for-byte the one the tag was made for
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.zw = cw.c.getWriter(cw.enc, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.code)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.zw != nil {
+		_, err := cw.zw.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush implements the http.Flusher interface.
+// A response that is flushed before MinSize is reached is compressed anyway.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(true)
+	}
+	if f, ok := cw.zw.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Hijack implements the http.Hijacker interface.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(cw.ResponseWriter).Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the response and returns the compressing writer to its pool.
+func (cw *compressWriter) close() {
+	if cw.hijacked {
+		return
+	}
+	if !cw.decided {
+		_ = cw.decide(false)
+	}
+	if cw.zw != nil {
+		_ = cw.zw.Close()
+		cw.c.putWriter(cw.enc, cw.zw)
+		cw.zw = nil
+	}
+}
+
+// bodyAllowed reports whether a response with the status code may have a body.
+func bodyAllowed(code int) bool {
+	return code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified
+}
@@ -0,0 +1,226 @@
+package muxify_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+// upperEncoder is a fake content coding that uppercases the body.
+type upperEncoder struct{}
+
+func (upperEncoder) Encoding() string { return "upper" }
+
+func (upperEncoder) NewWriter(w io.Writer) io.WriteCloser { return upperWriter{w} }
+
+type upperWriter struct{ w io.Writer }
+
+func (u upperWriter) Write(p []byte) (int, error) { return u.w.Write(bytes.ToUpper(p)) }
+
+func (u upperWriter) Close() error { return nil }
+
+func Test_Compress(t *testing.T) {
+	text := strings.Repeat("muxify ", 200)
+
+	testCases := map[string]struct {
+		acceptEncoding string
+		contentType    string
+		body           string
+		etag           string
+		expEncoding    string
+		expETag        string
+	}{
+		"ok - gzip": {
+			acceptEncoding: "gzip",
+			body:           text,
+			expEncoding:    "gzip",
+		},
+		"ok - deflate preferred by q-value": {
+			acceptEncoding: "gzip;q=0.5, deflate",
+			body:           text,
+			expEncoding:    "deflate",
+		},
+		"ok - wildcard": {
+			acceptEncoding: "*",
+			body:           text,
+			expEncoding:    "upper",
+		},
+		"ok - registered encoder": {
+			acceptEncoding: "gzip, upper",
+			body:           text,
+			expEncoding:    "upper",
+		},
+		"ok - strong etag made weak": {
+			acceptEncoding: "gzip",
+			body:           text,
+			etag:           `"v1"`,
+			expEncoding:    "gzip",
+			expETag:        `W/"v1"`,
+		},
+		"ok - weak etag kept": {
+			acceptEncoding: "gzip",
+			body:           text,
+			etag:           `W/"v1"`,
+			expEncoding:    "gzip",
+			expETag:        `W/"v1"`,
+		},
+		"no accept encoding": {
+			body: text,
+		},
+		"uncompressed keeps strong etag": {
+			body:    text,
+			etag:    `"v1"`,
+			expETag: `"v1"`,
+		},
+		"gzip not acceptable": {
+			acceptEncoding: "gzip;q=0",
+			body:           text,
+		},
+		"small body": {
+			acceptEncoding: "gzip",
+			body:           "muxify",
+		},
+		"compressed content type": {
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			body:           text,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			mux := muxify.NewMux()
+			mux.Use(muxify.Compress(muxify.CompressOptions{
+				Encoders: []muxify.Encoder{upperEncoder{}},
+			}))
+			mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				if tc.etag != "" {
+					w.Header().Set("ETag", tc.etag)
+				}
+				// write in chunks to cross the min size threshold
+				for _, chunk := range strings.SplitAfter(tc.body, " ") {
+					_, _ = w.Write([]byte(chunk))
+				}
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			got := rec.Header().Get("Content-Encoding")
+			if got != tc.expEncoding {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expEncoding, got)
+			}
+			if got := rec.Header().Get("ETag"); got != tc.expETag {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expETag, got)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "Accept-Encoding", got)
+			}
+
+			expBody := tc.body
+			if tc.expEncoding == "upper" {
+				expBody = strings.ToUpper(tc.body)
+			}
+			if body := decode(t, tc.expEncoding, rec.Body); body != expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", expBody, body)
+			}
+		})
+	}
+}
+
+func Test_Compress_Flush(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.Compress(muxify.CompressOptions{}))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("first"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Error(err)
+		}
+		_, _ = w.Write([]byte("second"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if !rec.Flushed {
+		t.Errorf("response was not flushed")
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "gzip", got)
+	}
+	if got := decode(t, "gzip", rec.Body); got != "firstsecond" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "firstsecond", got)
+	}
+}
+
+func Test_Compress_Hijack(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.Compress(muxify.CompressOptions{}))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(body); got != "hijacked" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "hijacked", got)
+	}
+}
+
+func decode(t *testing.T, encoding string, r io.Reader) string {
+	t.Helper()
+
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "deflate":
+		r = flate.NewReader(r)
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
@@ -0,0 +1,191 @@
+package muxify
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConcurrencyLimitOptions configures the ConcurrencyLimit middleware.
+type ConcurrencyLimitOptions struct {
+	// MaxInFlight is the maximum number of requests served at the same time.
+	MaxInFlight int
+	// MaxQueue is the maximum number of requests waiting for a slot.
+	// Requests beyond are shed right away.
+	MaxQueue int
+	// QueueTimeout is the maximum time a request waits for a slot.
+	// Zero waits until the request is canceled.
+	QueueTimeout time.Duration
+	// ExemptPatterns are registered patterns that are never limited
+	// or shed, e.g. health checks.
+	ExemptPatterns []string
+	// PriorityPatterns are registered patterns whose waiting requests
+	// get a slot before all others.
+	PriorityPatterns []string
+	// TargetLatency enables the adaptive mode. The limit shrinks while requests
+	// take longer than TargetLatency and grows back up to MaxInFlight otherwise.
+	TargetLatency time.Duration
+	// RetryAfter is sent in the Retry-After header of shed requests.
+	// Defaults to one second.
+	RetryAfter time.Duration
+	// ShedHandler is called for shed requests.
+	// Defaults to a plain 503 Service Unavailable response.
+	ShedHandler http.Handler
+}
+
+// ConcurrencyLimit returns a middleware that limits the number of requests
+// served at the same time. Requests beyond the limit wait in a bounded queue
+// and are shed with 503 Service Unavailable and a Retry-After header if the
+// queue is full or they waited too long.
+// Every call creates its own limiter, so each subrouter can Use its own limit.
+// It panics if MaxInFlight is not positive.
+func ConcurrencyLimit(opts ConcurrencyLimitOptions) Middleware {
+	if opts.MaxInFlight <= 0 {
+		panic("muxify: concurrency limit requires a positive max in flight")
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = time.Second
+	}
+	if opts.ShedHandler == nil {
+		opts.ShedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		})
+	}
+
+	l := &concurrencyLimiter{
+		opts:  opts,
+		limit: float64(opts.MaxInFlight),
+		high:  list.New(),
+		low:   list.New(),
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pattern := RoutePattern(r)
+			if slices.Contains(opts.ExemptPatterns, pattern) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !l.acquire(r, slices.Contains(opts.PriorityPatterns, pattern)) {
+				w.Header().Set("Retry-After", seconds(opts.RetryAfter))
+				opts.ShedHandler.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			defer func() {
+				l.release(time.Since(start))
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// queuedHook is called when a request starts waiting for a slot,
+// so tests know when the queue is filled.
+var queuedHook atomic.Pointer[func()]
+
+// concurrencyLimiter hands out slots to requests.
+type concurrencyLimiter struct {
+	opts ConcurrencyLimitOptions
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	high     *list.List
+	low      *list.List
+}
+
+// acquire waits for a slot and reports whether the request got one.
+func (l *concurrencyLimiter) acquire(r *http.Request, priority bool) bool {
+	l.mu.Lock()
+	if l.inFlight < l.current() && l.high.Len()+l.low.Len() == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return true
+	}
+	if l.high.Len()+l.low.Len() >= l.opts.MaxQueue {
+		l.mu.Unlock()
+		return false
+	}
+
+	queue := l.low
+	if priority {
+		queue = l.high
+	}
+	ready := make(chan struct{})
+	e := queue.PushBack(ready)
+	l.mu.Unlock()
+	if hook := queuedHook.Load(); hook != nil {
+		(*hook)()
+	}
+
+	var timeout <-chan time.Time
+	if l.opts.QueueTimeout > 0 {
+		timer := time.NewTimer(l.opts.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ready:
+		return true
+	case <-timeout:
+	case <-r.Context().Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-ready:
+		// the slot was granted while giving up
+		return true
+	default:
+		queue.Remove(e)
+	}
+	return false
+}
+
+// release frees a slot and adapts the limit to the latency of the request.
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.opts.TargetLatency > 0 {
+		if latency > l.opts.TargetLatency {
+			l.limit = math.Max(1, l.limit*0.9)
+		} else {
+			l.limit = math.Min(float64(l.opts.MaxInFlight), l.limit+1/l.limit)
+		}
+	}
+
+	l.inFlight--
+	l.grant()
+}
+
+// grant hands free slots to waiting requests, priority requests first.
+// It must be called with the lock held.
+func (l *concurrencyLimiter) grant() {
+	for l.inFlight < l.current() {
+		queue := l.high
+		if queue.Len() == 0 {
+			queue = l.low
+		}
+		if queue.Len() == 0 {
+			return
+		}
+		close(queue.Remove(queue.Front()).(chan struct{}))
+		l.inFlight++
+	}
+}
+
+// current returns the current limit.
+func (l *concurrencyLimiter) current() int {
+	return int(l.limit)
+}
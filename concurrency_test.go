@@ -0,0 +1,179 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/42LM/muxify"
+)
+
+// blockingMux returns a mux whose /slow routes block until release is closed.
+// Every request that entered a handler is reported on entered.
+func blockingMux(opts muxify.ConcurrencyLimitOptions) (mux *muxify.Mux, entered chan string, release chan struct{}) {
+	entered = make(chan string, 10)
+	release = make(chan struct{})
+
+	mux = muxify.NewMux()
+	mux.Use(muxify.ConcurrencyLimit(opts))
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		entered <- r.URL.Path
+		<-release
+	}
+	mux.HandleFunc("GET /slow", slow)
+	mux.HandleFunc("GET /slow/priority", slow)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {})
+
+	return mux, entered, release
+}
+
+// queuedRequests returns a channel that receives a value
+// whenever a request starts waiting for a slot.
+func queuedRequests(t *testing.T) <-chan struct{} {
+	queued := make(chan struct{}, 10)
+	t.Cleanup(muxify.OnConcurrencyQueued(func() { queued <- struct{}{} }))
+	return queued
+}
+
+func serve(mux http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func Test_ConcurrencyLimit(t *testing.T) {
+	mux, entered, release := blockingMux(muxify.ConcurrencyLimitOptions{
+		MaxInFlight:    1,
+		MaxQueue:       1,
+		ExemptPatterns: []string{"GET /healthz"},
+		RetryAfter:     2 * time.Second,
+	})
+	queued := queuedRequests(t)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serve(mux, "/slow").Code
+		}()
+		if i == 0 {
+			<-entered
+		}
+	}
+
+	// wait until the second request is queued
+	<-queued
+
+	rec := serve(mux, "/slow")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusServiceUnavailable, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "2", got)
+	}
+	if rec := serve(mux, "/healthz"); rec.Code != http.StatusOK {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusOK, rec.Code)
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("\nwant: %v\ngot: %v\n", http.StatusOK, code)
+		}
+	}
+}
+
+func Test_ConcurrencyLimit_QueueTimeout(t *testing.T) {
+	mux, entered, release := blockingMux(muxify.ConcurrencyLimitOptions{
+		MaxInFlight:  1,
+		MaxQueue:     1,
+		QueueTimeout: 10 * time.Millisecond,
+	})
+	defer close(release)
+
+	go serve(mux, "/slow")
+	<-entered
+
+	if rec := serve(mux, "/slow"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+func Test_ConcurrencyLimit_Priority(t *testing.T) {
+	mux, entered, release := blockingMux(muxify.ConcurrencyLimitOptions{
+		MaxInFlight:      1,
+		MaxQueue:         2,
+		PriorityPatterns: []string{"GET /slow/priority"},
+	})
+	queued := queuedRequests(t)
+
+	var wg sync.WaitGroup
+	for i, path := range []string{"/slow", "/slow", "/slow/priority"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(mux, path)
+		}()
+		// keep the order of arrival
+		if i == 0 {
+			<-entered
+		} else {
+			<-queued
+		}
+	}
+
+	order := []string{"/slow"}
+	release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		order = append(order, <-entered)
+		release <- struct{}{}
+	}
+	wg.Wait()
+
+	want := []string{"/slow", "/slow/priority", "/slow"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("\nwant: %v\ngot: %v\n", want, order)
+			break
+		}
+	}
+}
+
+func Test_ConcurrencyLimit_Adaptive(t *testing.T) {
+	mux, entered, release := blockingMux(muxify.ConcurrencyLimitOptions{
+		MaxInFlight:   4,
+		TargetLatency: time.Nanosecond,
+	})
+
+	started := make(chan struct{})
+	blocked := make(chan struct{})
+	mux.HandleFunc("GET /block", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-blocked
+	})
+
+	// slow requests shrink the limit down to one
+	go func() {
+		for range entered {
+			time.Sleep(time.Millisecond)
+			release <- struct{}{}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		serve(mux, "/slow")
+	}
+
+	go serve(mux, "/block")
+	<-started
+	defer close(blocked)
+
+	if rec := serve(mux, "/healthz"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusServiceUnavailable, rec.Code)
+	}
+}
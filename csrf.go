@@ -0,0 +1,185 @@
+package muxify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// CSRFMode selects how the CSRF middleware issues and checks tokens.
+type CSRFMode int
+
+const (
+	// CSRFDoubleSubmit stores a random token in a cookie.
+	// Unsafe requests must submit the same token.
+	CSRFDoubleSubmit CSRFMode = iota
+	// CSRFSynchronizer derives the token from the session of the client
+	// with an HMAC, so it does not need to be stored on the client or the server.
+	// Unsafe requests must submit the token of their session.
+	CSRFSynchronizer
+)
+
+// CSRFOptions configures the CSRF middleware.
+type CSRFOptions struct {
+	// Mode selects double submit cookie or synchronizer tokens.
+	Mode CSRFMode
+	// Key signs the synchronizer tokens. Required for CSRFSynchronizer.
+	Key []byte
+	// SessionID returns the session of the request. Required for CSRFSynchronizer.
+	SessionID func(r *http.Request) string
+	// CookieName is the name of the double submit cookie. Defaults to "_csrf".
+	CookieName string
+	// CookiePath is the path of the double submit cookie. Defaults to "/".
+	CookiePath string
+	// HeaderName is the request header carrying the token. Defaults to "X-CSRF-Token".
+	HeaderName string
+	// FieldName is the form field carrying the token. Defaults to "csrf_token".
+	FieldName string
+	// TrustedOrigins are additional hosts (e.g. "app.example.com")
+	// unsafe requests may originate from.
+	TrustedOrigins []string
+	// ExemptPatterns are registered patterns that are not protected.
+	ExemptPatterns []string
+	// ErrorHandler is called for rejected requests.
+	// Defaults to a plain 403 Forbidden response.
+	ErrorHandler http.Handler
+}
+
+// CSRF returns a middleware that protects unsafe requests (all but GET, HEAD,
+// OPTIONS and TRACE) against cross-site request forgery.
+// Unsafe requests must come from the same origin according to the
+// Sec-Fetch-Site and Origin headers and must carry a valid token in the
+// header or form field. Templates get the token with CSRFToken.
+// It panics if CSRFSynchronizer is used without Key or SessionID.
+func CSRF(opts CSRFOptions) Middleware {
+	if opts.Mode == CSRFSynchronizer && (len(opts.Key) == 0 || opts.SessionID == nil) {
+		panic("muxify: csrf synchronizer mode requires a key and a session id func")
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = "_csrf"
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = "X-CSRF-Token"
+	}
+	if opts.FieldName == "" {
+		opts.FieldName = "csrf_token"
+	}
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var token string
+			switch opts.Mode {
+			case CSRFSynchronizer:
+				if sessionID := opts.SessionID(r); sessionID != "" {
+					token = signCSRFToken(opts.Key, sessionID)
+				}
+			default:
+				if c, err := r.Cookie(opts.CookieName); err == nil && c.Value != "" {
+					token = c.Value
+				} else {
+					token = newCSRFToken()
+					http.SetCookie(w, &http.Cookie{
+						Name:     opts.CookieName,
+						Value:    token,
+						Path:     opts.CookiePath,
+						HttpOnly: true,
+						Secure:   r.TLS != nil,
+						SameSite: http.SameSiteLaxMode,
+					})
+				}
+			}
+			r = r.WithContext(context.WithValue(r.Context(), csrfTokenKey, token))
+
+			if safeMethod(r.Method) || slices.Contains(opts.ExemptPatterns, RoutePattern(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !sameOrigin(r, opts.TrustedOrigins) {
+				opts.ErrorHandler.ServeHTTP(w, r)
+				return
+			}
+
+			submitted := r.Header.Get(opts.HeaderName)
+			if submitted == "" {
+				submitted = r.PostFormValue(opts.FieldName)
+			}
+			if token == "" || !hmac.Equal([]byte(submitted), []byte(token)) {
+				opts.ErrorHandler.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CSRFToken returns the CSRF token of the request for use in forms
+// or an empty string if the CSRF middleware is not used.
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfTokenKey).(string)
+	return token
+}
+
+// safeMethod reports whether the method is safe according to RFC 9110.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// sameOrigin reports whether the request originates from the same
+// or a trusted origin according to the Sec-Fetch-Site and Origin headers.
+// Requests without these headers (e.g. from old browsers or non-browser clients)
+// are let through and rely on the token alone.
+func sameOrigin(r *http.Request, trustedOrigins []string) bool {
+	var originHost string
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		originHost = u.Host
+	}
+	if originHost != "" && slices.Contains(trustedOrigins, originHost) {
+		return true
+	}
+
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+		return originHost == "" || strings.EqualFold(originHost, r.Host)
+	}
+	return false
+}
+
+// newCSRFToken returns a new random token.
+func newCSRFToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// signCSRFToken returns the synchronizer token of the session.
+func signCSRFToken(key []byte, sessionID string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,196 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_CSRF_DoubleSubmit(t *testing.T) {
+	mux := muxify.NewMux()
+
+	html := mux.Subrouter()
+	html.Use(muxify.CSRF(muxify.CSRFOptions{
+		TrustedOrigins: []string{"app.example.com"},
+		ExemptPatterns: []string{"POST /webhook"},
+	}))
+	html.HandleFunc("GET /form", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(muxify.CSRFToken(r)))
+	})
+	html.HandleFunc("POST /form", func(w http.ResponseWriter, r *http.Request) {})
+	html.HandleFunc("POST /webhook", func(w http.ResponseWriter, r *http.Request) {})
+
+	api := mux.Subrouter().Prefix("/api")
+	api.HandleFunc("POST /users", func(w http.ResponseWriter, r *http.Request) {})
+
+	// fetch a token
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/form", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != rec.Body.String() {
+		t.Fatalf("token cookie does not match CSRFToken")
+	}
+	token := rec.Body.String()
+
+	testCases := map[string]struct {
+		path          string
+		headerToken   string
+		formToken     string
+		noCookie      bool
+		headers       map[string]string
+		expStatusCode int
+	}{
+		"ok - header token": {
+			path:          "/form",
+			headerToken:   token,
+			expStatusCode: http.StatusOK,
+		},
+		"ok - form token": {
+			path:          "/form",
+			formToken:     token,
+			expStatusCode: http.StatusOK,
+		},
+		"ok - same origin": {
+			path:          "/form",
+			headerToken:   token,
+			headers:       map[string]string{"Origin": "http://example.com", "Sec-Fetch-Site": "same-origin"},
+			expStatusCode: http.StatusOK,
+		},
+		"ok - trusted origin": {
+			path:          "/form",
+			headerToken:   token,
+			headers:       map[string]string{"Origin": "https://app.example.com", "Sec-Fetch-Site": "same-site"},
+			expStatusCode: http.StatusOK,
+		},
+		"ok - exempt pattern": {
+			path:          "/webhook",
+			expStatusCode: http.StatusOK,
+		},
+		"ok - api subrouter": {
+			path:          "/api/users",
+			expStatusCode: http.StatusOK,
+		},
+		"missing token": {
+			path:          "/form",
+			expStatusCode: http.StatusForbidden,
+		},
+		"wrong token": {
+			path:          "/form",
+			headerToken:   "forged",
+			expStatusCode: http.StatusForbidden,
+		},
+		"missing cookie": {
+			path:          "/form",
+			headerToken:   token,
+			noCookie:      true,
+			expStatusCode: http.StatusForbidden,
+		},
+		"cross site": {
+			path:          "/form",
+			headerToken:   token,
+			headers:       map[string]string{"Sec-Fetch-Site": "cross-site"},
+			expStatusCode: http.StatusForbidden,
+		},
+		"foreign origin": {
+			path:          "/form",
+			headerToken:   token,
+			headers:       map[string]string{"Origin": "https://evil.example.org"},
+			expStatusCode: http.StatusForbidden,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			form := url.Values{}
+			if tc.formToken != "" {
+				form.Set("csrf_token", tc.formToken)
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.headerToken != "" {
+				req.Header.Set("X-CSRF-Token", tc.headerToken)
+			}
+			if !tc.noCookie {
+				req.AddCookie(cookies[0])
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+		})
+	}
+}
+
+func Test_CSRF_Synchronizer(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.CSRF(muxify.CSRFOptions{
+		Mode: muxify.CSRFSynchronizer,
+		Key:  []byte("muxify-secret"),
+		SessionID: func(r *http.Request) string {
+			c, err := r.Cookie("session")
+			if err != nil {
+				return ""
+			}
+			return c.Value
+		},
+	}))
+	mux.HandleFunc("GET /form", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(muxify.CSRFToken(r)))
+	})
+	mux.HandleFunc("POST /form", func(w http.ResponseWriter, r *http.Request) {})
+
+	tokenOf := func(session string) string {
+		req := httptest.NewRequest(http.MethodGet, "/form", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: session})
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if len(rec.Result().Cookies()) != 0 {
+			t.Errorf("synchronizer mode set a cookie")
+		}
+		return rec.Body.String()
+	}
+
+	testCases := map[string]struct {
+		session       string
+		token         string
+		expStatusCode int
+	}{
+		"ok": {
+			session:       "luke",
+			token:         tokenOf("luke"),
+			expStatusCode: http.StatusOK,
+		},
+		"token of other session": {
+			session:       "luke",
+			token:         tokenOf("vader"),
+			expStatusCode: http.StatusForbidden,
+		},
+		"no session": {
+			token:         tokenOf(""),
+			expStatusCode: http.StatusForbidden,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/form", nil)
+			req.Header.Set("X-CSRF-Token", tc.token)
+			if tc.session != "" {
+				req.AddCookie(&http.Cookie{Name: "session", Value: tc.session})
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package muxify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETagOptions configures the ETag middleware.
+type ETagOptions struct {
+	// Weak marks generated ETags as weak validators.
+	Weak bool
+}
+
+// ETag returns a middleware that answers conditional GET and HEAD requests
+// (If-None-Match, If-Modified-Since) with 304 Not Modified.
+// Handlers can provide validators by setting the ETag or Last-Modified header
+// before writing, otherwise successful responses are buffered and an ETag
+// is generated from a hash of the body. HEAD responses have no body to hash,
+// they only carry the validators provided by the handler.
+func ETag(opts ETagOptions) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &etagWriter{ResponseWriter: w, r: r, weak: opts.Weak}
+			next.ServeHTTP(ew, r)
+			ew.finish()
+		})
+	}
+}
+
+// CacheControl returns a middleware that sets the Cache-Control header,
+// e.g. a caching policy per subrouter. Subrouters and handlers can override it.
+// It is removed from error responses.
+func CacheControl(value string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := WrapResponseWriter(w)
+			rw.Header().Set("Cache-Control", value)
+			rw.OnWriteHeader(func(code int) {
+				if code >= http.StatusBadRequest && rw.Header().Get("Cache-Control") == value {
+					rw.Header().Del("Cache-Control")
+				}
+			})
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// etagWriter modes.
+const (
+	etagBuffer = iota
+	etagPassthrough
+	etagDiscard
+)
+
+// etagWriter buffers a successful response to generate its ETag.
+type etagWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	weak        bool
+	code        int
+	buf         bytes.Buffer
+	mode        int
+	wroteHeader bool
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if ew.wroteHeader {
+		return
+	}
+	ew.wroteHeader = true
+	ew.code = code
+
+	h := ew.Header()
+	switch {
+	case code != http.StatusOK:
+		ew.mode = etagPassthrough
+		ew.ResponseWriter.WriteHeader(code)
+	case h.Get("ETag") != "" || h.Get("Last-Modified") != "":
+		// the handler provided validators, no need to buffer
+		if notModified(ew.r, h) {
+			ew.mode = etagDiscard
+			writeNotModified(ew.ResponseWriter)
+			return
+		}
+		ew.mode = etagPassthrough
+		ew.ResponseWriter.WriteHeader(code)
+	case ew.r.Method == http.MethodHead:
+		// the hash of the empty body is not the ETag of the GET response
+		ew.mode = etagPassthrough
+		ew.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (ew *etagWriter) Write(p []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+
+	switch ew.mode {
+	case etagBuffer:
+		return ew.buf.Write(p)
+	case etagDiscard:
+		return len(p), nil
+	}
+	return ew.ResponseWriter.Write(p)
+}
+
+// Flush implements the http.Flusher interface.
+// A flushed response is streamed and gets no generated ETag.
+func (ew *etagWriter) Flush() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.mode == etagBuffer {
+		ew.mode = etagPassthrough
+		ew.ResponseWriter.WriteHeader(ew.code)
+		_, _ = ew.ResponseWriter.Write(ew.buf.Bytes())
+		ew.buf.Reset()
+	}
+	_ = http.NewResponseController(ew.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// finish generates the ETag of a buffered response and writes it
+// or answers with 304 Not Modified.
+func (ew *etagWriter) finish() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.mode != etagBuffer {
+		return
+	}
+
+	sum := sha256.Sum256(ew.buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if ew.weak {
+		etag = "W/" + etag
+	}
+	h := ew.Header()
+	h.Set("ETag", etag)
+
+	if notModified(ew.r, h) {
+		writeNotModified(ew.ResponseWriter)
+		return
+	}
+	ew.ResponseWriter.WriteHeader(ew.code)
+	_, _ = ew.ResponseWriter.Write(ew.buf.Bytes())
+}
+
+// notModified evaluates the If-None-Match and If-Modified-Since
+// preconditions of the request against the response header.
+func notModified(r *http.Request, h http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := h.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakMatch(candidate, etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(h.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lm.Truncate(time.Second).After(ims)
+}
+
+// weakMatch compares two entity tags with the weak comparison function.
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// writeNotModified answers with 304 Not Modified without the
+// representation headers.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
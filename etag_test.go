@@ -0,0 +1,215 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_ETag(t *testing.T) {
+	lastModified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mux := muxify.NewMux()
+	mux.Use(muxify.ETag(muxify.ETagOptions{}))
+	mux.HandleFunc("GET /generated", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("GET /provided", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		_, _ = w.Write([]byte("provided"))
+	})
+	mux.HandleFunc("GET /missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing", http.StatusNotFound)
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/generated", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" || rec.Body.String() != "hello" {
+		t.Fatalf("\nwant: etag and body\ngot: %q %q\n", etag, rec.Body.String())
+	}
+
+	testCases := map[string]struct {
+		path          string
+		header        map[string]string
+		expStatusCode int
+		expBody       string
+	}{
+		"generated etag matches": {
+			path:          "/generated",
+			header:        map[string]string{"If-None-Match": `"other", ` + etag},
+			expStatusCode: http.StatusNotModified,
+		},
+		"generated etag matches weakly": {
+			path:          "/generated",
+			header:        map[string]string{"If-None-Match": "W/" + etag},
+			expStatusCode: http.StatusNotModified,
+		},
+		"generated etag differs": {
+			path:          "/generated",
+			header:        map[string]string{"If-None-Match": `"other"`},
+			expStatusCode: http.StatusOK,
+			expBody:       "hello",
+		},
+		"provided etag matches": {
+			path:          "/provided",
+			header:        map[string]string{"If-None-Match": `"v1"`},
+			expStatusCode: http.StatusNotModified,
+		},
+		"if-none-match takes precedence": {
+			path: "/provided",
+			header: map[string]string{
+				"If-None-Match":     `"v0"`,
+				"If-Modified-Since": lastModified.Format(http.TimeFormat),
+			},
+			expStatusCode: http.StatusOK,
+			expBody:       "provided",
+		},
+		"not modified since": {
+			path:          "/provided",
+			header:        map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			expStatusCode: http.StatusNotModified,
+		},
+		"modified since": {
+			path:          "/provided",
+			header:        map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)},
+			expStatusCode: http.StatusOK,
+			expBody:       "provided",
+		},
+		"errors are passed through": {
+			path:          "/missing",
+			header:        map[string]string{"If-None-Match": "*"},
+			expStatusCode: http.StatusNotFound,
+			expBody:       "missing\n",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if rec.Body.String() != tc.expBody {
+				t.Errorf("\nwant: %q\ngot: %q\n", tc.expBody, rec.Body.String())
+			}
+			if tc.expStatusCode == http.StatusNotModified && rec.Header().Get("Content-Type") != "" {
+				t.Errorf("\nwant: no content type\ngot: %v\n", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func Test_ETag_Head(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.ETag(muxify.ETagOptions{}))
+	mux.HandleFunc("GET /generated", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "hello.txt", time.Time{}, strings.NewReader("hello"))
+	})
+	mux.HandleFunc("GET /provided", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "hello.txt", time.Time{}, strings.NewReader("hello"))
+	})
+
+	testCases := map[string]struct {
+		path          string
+		header        map[string]string
+		expStatusCode int
+		expETag       string
+	}{
+		"generated etag omitted": {
+			path:          "/generated",
+			expStatusCode: http.StatusOK,
+		},
+		"provided etag": {
+			path:          "/provided",
+			expStatusCode: http.StatusOK,
+			expETag:       `"v1"`,
+		},
+		"provided etag matches": {
+			path:          "/provided",
+			header:        map[string]string{"If-None-Match": `"v1"`},
+			expStatusCode: http.StatusNotModified,
+			expETag:       `"v1"`,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodHead, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if got := rec.Header().Get("ETag"); got != tc.expETag {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expETag, got)
+			}
+		})
+	}
+}
+
+func Test_ETag_Weak(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.ETag(muxify.ETagOptions{Weak: true}))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if etag := rec.Header().Get("ETag"); !strings.HasPrefix(etag, `W/"`) {
+		t.Errorf("\nwant: weak etag\ngot: %v\n", etag)
+	}
+}
+
+func Test_CacheControl(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.CacheControl("no-cache"))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /own", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private")
+	})
+
+	assets := mux.Subrouter().Prefix("/assets")
+	assets.Use(muxify.CacheControl("public, max-age=31536000, immutable"))
+	assets.HandleFunc("GET /app.js", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("js"))
+	})
+	assets.HandleFunc("GET /missing.js", http.NotFound)
+
+	testCases := map[string]struct {
+		path            string
+		expCacheControl string
+	}{
+		"root policy":               {path: "/", expCacheControl: "no-cache"},
+		"handler policy":            {path: "/own", expCacheControl: "private"},
+		"subrouter policy":          {path: "/assets/app.js", expCacheControl: "public, max-age=31536000, immutable"},
+		"errors are left untouched": {path: "/assets/missing.js", expCacheControl: ""},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if got := rec.Header().Get("Cache-Control"); got != tc.expCacheControl {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expCacheControl, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package muxify
+
+// OnConcurrencyQueued calls f whenever a request starts waiting for a slot
+// of a ConcurrencyLimit middleware. The returned func removes the hook.
+func OnConcurrencyQueued(f func()) (remove func()) {
+	queuedHook.Store(&f)
+	return func() { queuedHook.Store(nil) }
+}
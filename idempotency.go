@@ -0,0 +1,292 @@
+package muxify
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyMaxKeys is the number of keys the in-memory store
+// keeps when no other size is given.
+const DefaultIdempotencyMaxKeys = 10000
+
+// DefaultIdempotencyTTL is the default time a response is kept for replays.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// DefaultIdempotencyMaxResponseBytes is the default size limit of a kept response body.
+const DefaultIdempotencyMaxResponseBytes = 1 << 20
+
+// DefaultIdempotencyMaxRequestBytes is the default size limit of a request body
+// read for the fingerprint.
+const DefaultIdempotencyMaxRequestBytes = 1 << 20
+
+// IdempotencyRecord is the state of an idempotency key.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request that used the key first.
+	Fingerprint string
+	// InFlight reports whether the first request is still being served.
+	InFlight bool
+	// StatusCode, Header and Body are the response of the first request.
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IdempotencyStore holds the records of idempotency keys.
+// Implement it to share keys between multiple instances of a service.
+type IdempotencyStore interface {
+	// Reserve stores an in-flight record with the fingerprint for the key
+	// unless the key has a record. It returns the existing record or nil.
+	Reserve(key, fingerprint string, ttl time.Duration, now time.Time) (*IdempotencyRecord, error)
+	// Complete replaces the in-flight record of the key with the response.
+	Complete(key string, record *IdempotencyRecord, ttl time.Duration, now time.Time) error
+	// Release removes the in-flight record of the key, so the request can be retried.
+	Release(key string) error
+}
+
+// IdempotencyOptions configures the Idempotency middleware.
+type IdempotencyOptions struct {
+	// Patterns are the registered patterns the middleware applies to.
+	// Empty applies to all routes.
+	Patterns []string
+	// Required rejects requests without an Idempotency-Key header
+	// with 400 Bad Request.
+	Required bool
+	// TTL is the time a response is kept for replays.
+	// Defaults to DefaultIdempotencyTTL.
+	TTL time.Duration
+	// MaxResponseBytes limits the size of a kept response body. Requests with
+	// larger or streamed responses can be retried. Defaults to DefaultIdempotencyMaxResponseBytes.
+	MaxResponseBytes int64
+	// MaxRequestBytes limits the size of a request body with an Idempotency-Key,
+	// which is read into memory for the fingerprint. Larger requests are answered
+	// with 413 Request Entity Too Large. Defaults to DefaultIdempotencyMaxRequestBytes.
+	MaxRequestBytes int64
+	// Store holds the keys.
+	// Defaults to a new in-memory store with DefaultIdempotencyMaxKeys keys.
+	Store IdempotencyStore
+}
+
+// Idempotency returns a middleware that makes POST and PATCH requests with
+// an Idempotency-Key header safe to retry. The first response of a key is
+// kept and replayed with an Idempotent-Replayed header for retries.
+// Keys are scoped to the principal of the request and bound to a fingerprint
+// of the method, the URL and the body: a retry while the first request is
+// in flight gets 409 Conflict, reusing a key for another request gets
+// 422 Unprocessable Entity.
+// Server errors (5xx) are not kept, so the request can be retried.
+// If the store fails the request is answered with 500 Internal Server Error.
+func Idempotency(opts IdempotencyOptions) Middleware {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultIdempotencyTTL
+	}
+	if opts.MaxResponseBytes <= 0 {
+		opts.MaxResponseBytes = DefaultIdempotencyMaxResponseBytes
+	}
+	if opts.MaxRequestBytes <= 0 {
+		opts.MaxRequestBytes = DefaultIdempotencyMaxRequestBytes
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore(DefaultIdempotencyMaxKeys)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost && r.Method != http.MethodPatch ||
+				len(opts.Patterns) > 0 && !slices.Contains(opts.Patterns, RoutePattern(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			idempotencyKey := r.Header.Get("Idempotency-Key")
+			if idempotencyKey == "" {
+				if opts.Required {
+					http.Error(w, "missing Idempotency-Key header", http.StatusBadRequest)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > opts.MaxRequestBytes {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, opts.MaxRequestBytes))
+			if err != nil {
+				// the limit of a MaxBody middleware applies as well
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			key := idempotencyKey
+			if p := RequestPrincipal(r); p != nil {
+				key = p.Scheme + "\x00" + p.Subject + "\x00" + key
+			}
+			fingerprint := requestFingerprint(r, body)
+
+			record, err := opts.Store.Reserve(key, fingerprint, opts.TTL, time.Now())
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			switch {
+			case record == nil:
+			case record.Fingerprint != fingerprint:
+				http.Error(w, "Idempotency-Key reused for another request", http.StatusUnprocessableEntity)
+				return
+			case record.InFlight:
+				http.Error(w, "request with the same Idempotency-Key in flight", http.StatusConflict)
+				return
+			default:
+				h := w.Header()
+				for k, v := range record.Header {
+					h[k] = slices.Clone(v)
+				}
+				h.Set("Idempotent-Replayed", "true")
+				w.WriteHeader(record.StatusCode)
+				_, _ = w.Write(record.Body)
+				return
+			}
+
+			cw := newCacheWriter(w, opts.MaxResponseBytes)
+			completed := false
+			defer func() {
+				if !completed {
+					_ = opts.Store.Release(key)
+				}
+			}()
+
+			next.ServeHTTP(cw, r)
+
+			if cw.status == 0 {
+				cw.WriteHeader(http.StatusOK)
+			}
+			if cw.status >= http.StatusInternalServerError || cw.skip {
+				return
+			}
+			completed = opts.Store.Complete(key, &IdempotencyRecord{
+				Fingerprint: fingerprint,
+				StatusCode:  cw.status,
+				Header:      cw.header,
+				Body:        bytes.Clone(cw.body.Bytes()),
+			}, opts.TTL, time.Now()) == nil
+		})
+	}
+}
+
+// requestFingerprint returns a hash of the method, the URL and the body of the request.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// memoryIdempotencyStore is an in-memory IdempotencyStore
+// that evicts the least recently used keys.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	maxKeys int
+	records map[string]*list.Element
+	lru     *list.List
+}
+
+// idempotencyEntry is a record of the memoryIdempotencyStore.
+type idempotencyEntry struct {
+	key     string
+	record  *IdempotencyRecord
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an in-memory IdempotencyStore that keeps
+// at most maxKeys keys. The least recently used keys are evicted first.
+func NewMemoryIdempotencyStore(maxKeys int) IdempotencyStore {
+	if maxKeys <= 0 {
+		maxKeys = DefaultIdempotencyMaxKeys
+	}
+	return &memoryIdempotencyStore{
+		maxKeys: maxKeys,
+		records: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Reserve implements the IdempotencyStore interface.
+func (s *memoryIdempotencyStore) Reserve(key, fingerprint string, ttl time.Duration, now time.Time) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.records[key]; ok {
+		e := el.Value.(*idempotencyEntry)
+		if now.Before(e.expires) {
+			s.lru.MoveToFront(el)
+			record := *e.record
+			return &record, nil
+		}
+		s.lru.Remove(el)
+		delete(s.records, key)
+	}
+
+	s.records[key] = s.lru.PushFront(&idempotencyEntry{
+		key:     key,
+		record:  &IdempotencyRecord{Fingerprint: fingerprint, InFlight: true},
+		expires: now.Add(ttl),
+	})
+	s.evict()
+
+	return nil, nil
+}
+
+// Complete implements the IdempotencyStore interface.
+func (s *memoryIdempotencyStore) Complete(key string, record *IdempotencyRecord, ttl time.Duration, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.InFlight = false
+	if el, ok := s.records[key]; ok {
+		e := el.Value.(*idempotencyEntry)
+		e.record = record
+		e.expires = now.Add(ttl)
+		s.lru.MoveToFront(el)
+		return nil
+	}
+	s.records[key] = s.lru.PushFront(&idempotencyEntry{key: key, record: record, expires: now.Add(ttl)})
+	s.evict()
+	return nil
+}
+
+// Release implements the IdempotencyStore interface.
+func (s *memoryIdempotencyStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.records[key]; ok && el.Value.(*idempotencyEntry).record.InFlight {
+		s.lru.Remove(el)
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// evict removes the least recently used keys beyond maxKeys.
+// It must be called with the lock held.
+func (s *memoryIdempotencyStore) evict() {
+	for s.lru.Len() > s.maxKeys {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.records, oldest.Value.(*idempotencyEntry).key)
+	}
+}
@@ -0,0 +1,228 @@
+package muxify_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_Idempotency(t *testing.T) {
+	var charges atomic.Int64
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	mux := muxify.NewMux()
+	mux.Use(muxify.BasicAuth(muxify.BasicAuthOptions{
+		Validate: muxify.BasicUsers(map[string]string{"alice": "secret", "bob": "secret"}),
+	}))
+	mux.Use(muxify.Idempotency(muxify.IdempotencyOptions{
+		Patterns: []string{"POST /charges", "POST /slow"},
+	}))
+	mux.HandleFunc("POST /charges", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Location", fmt.Sprintf("/charges/%d", charges.Add(1)))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	})
+	mux.HandleFunc("POST /slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	mux.HandleFunc("POST /unconfigured", func(w http.ResponseWriter, r *http.Request) {
+		charges.Add(1)
+	})
+
+	post := func(user, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.SetBasicAuth(user, "secret")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := post("alice", "/charges", "k1", "10 EUR")
+	if first.Code != http.StatusCreated || first.Header().Get("Location") != "/charges/1" {
+		t.Fatalf("\nwant: %v /charges/1\ngot: %v %v\n", http.StatusCreated, first.Code, first.Header().Get("Location"))
+	}
+
+	testCases := map[string]struct {
+		user          string
+		path          string
+		key           string
+		body          string
+		expStatusCode int
+		expReplayed   bool
+	}{
+		"retry is replayed": {
+			user:          "alice",
+			path:          "/charges",
+			key:           "k1",
+			body:          "10 EUR",
+			expStatusCode: http.StatusCreated,
+			expReplayed:   true,
+		},
+		"key reused with another body": {
+			user:          "alice",
+			path:          "/charges",
+			key:           "k1",
+			body:          "20 EUR",
+			expStatusCode: http.StatusUnprocessableEntity,
+		},
+		"key of another principal": {
+			user:          "bob",
+			path:          "/charges",
+			key:           "k1",
+			body:          "10 EUR",
+			expStatusCode: http.StatusCreated,
+		},
+		"no key": {
+			user:          "alice",
+			path:          "/charges",
+			body:          "10 EUR",
+			expStatusCode: http.StatusCreated,
+		},
+		"unconfigured route": {
+			user:          "alice",
+			path:          "/unconfigured",
+			key:           "k1",
+			expStatusCode: http.StatusOK,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			before := charges.Load()
+			rec := post(tc.user, tc.path, tc.key, tc.body)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tc.expReplayed {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expReplayed, replayed)
+			}
+			if tc.expReplayed {
+				if rec.Body.String() != first.Body.String() || rec.Header().Get("Location") != first.Header().Get("Location") {
+					t.Errorf("\nwant: %q %v\ngot: %q %v\n", first.Body.String(), first.Header().Get("Location"), rec.Body.String(), rec.Header().Get("Location"))
+				}
+				if charges.Load() != before {
+					t.Errorf("\nwant: no new charge\ngot: %v\n", charges.Load()-before)
+				}
+			}
+		})
+	}
+
+	t.Run("in flight duplicate", func(t *testing.T) {
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			done <- post("alice", "/slow", "k2", "")
+		}()
+		<-started
+
+		if rec := post("alice", "/slow", "k2", ""); rec.Code != http.StatusConflict {
+			t.Errorf("\nwant: %v\ngot: %v\n", http.StatusConflict, rec.Code)
+		}
+		close(release)
+		if rec := <-done; rec.Code != http.StatusOK {
+			t.Errorf("\nwant: %v\ngot: %v\n", http.StatusOK, rec.Code)
+		}
+	})
+}
+
+func Test_Idempotency_MaxRequestBytes(t *testing.T) {
+	idempotency := muxify.Idempotency(muxify.IdempotencyOptions{MaxRequestBytes: 8})
+	mux := muxify.NewMux()
+	root := mux.Subrouter()
+	root.Use(idempotency)
+	root.HandleFunc("POST /{$}", func(w http.ResponseWriter, r *http.Request) {})
+	limited := mux.Subrouter().Prefix("/limited")
+	limited.Use(muxify.MaxBody(4), idempotency)
+	limited.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {})
+
+	testCases := map[string]struct {
+		path          string
+		body          string
+		chunked       bool
+		expStatusCode int
+	}{
+		"ok": {
+			path:          "/",
+			body:          "10 EUR",
+			expStatusCode: http.StatusOK,
+		},
+		"too large": {
+			path:          "/",
+			body:          "1000000 EUR",
+			expStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		"chunked too large": {
+			path:          "/",
+			body:          "1000000 EUR",
+			chunked:       true,
+			expStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		"max body of the route": {
+			path:          "/limited/",
+			body:          "10 EUR",
+			chunked:       true,
+			expStatusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Idempotency-Key", tname)
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+		})
+	}
+}
+
+func Test_Idempotency_ServerError(t *testing.T) {
+	var calls atomic.Int64
+	mux := muxify.NewMux()
+	mux.Use(muxify.Idempotency(muxify.IdempotencyOptions{Required: true}))
+	mux.HandleFunc("POST /", func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	})
+
+	post := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post(""); code != http.StatusBadRequest {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusBadRequest, code)
+	}
+	if code := post("k"); code != http.StatusServiceUnavailable {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusServiceUnavailable, code)
+	}
+	// the failed request was not kept and can be retried
+	if code := post("k"); code != http.StatusOK {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusOK, code)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("\nwant: %v\ngot: %v\n", 2, calls.Load())
+	}
+}
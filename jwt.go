@@ -0,0 +1,278 @@
+package muxify
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// KeySet holds the keys to verify JWT signatures by key ID ("kid").
+// A key is a []byte secret for HS256, an *rsa.PublicKey for RS256
+// or an *ecdsa.PublicKey on the P-256 curve for ES256.
+type KeySet map[string]any
+
+// ParseJWKS parses a JSON Web Key Set (RFC 7517) into a KeySet.
+// Supported key types are "oct", "RSA" and "EC" (P-256).
+func ParseJWKS(data []byte) (KeySet, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			K   string `json:"k"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("muxify: parse jwks: %w", err)
+	}
+
+	keys := make(KeySet, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return nil, fmt.Errorf("muxify: parse jwks key %q: %w", k.Kid, err)
+			}
+			keys[k.Kid] = secret
+		case "RSA":
+			n, err := decodeBigInt(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("muxify: parse jwks key %q: %w", k.Kid, err)
+			}
+			e, err := decodeBigInt(k.E)
+			if err != nil || !e.IsInt64() {
+				return nil, fmt.Errorf("muxify: parse jwks key %q: invalid exponent", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				return nil, fmt.Errorf("muxify: parse jwks key %q: unsupported curve %q", k.Kid, k.Crv)
+			}
+			x, err := decodeBigInt(k.X)
+			if err != nil {
+				return nil, fmt.Errorf("muxify: parse jwks key %q: %w", k.Kid, err)
+			}
+			y, err := decodeBigInt(k.Y)
+			if err != nil {
+				return nil, fmt.Errorf("muxify: parse jwks key %q: %w", k.Kid, err)
+			}
+			if !elliptic.P256().IsOnCurve(x, y) {
+				return nil, fmt.Errorf("muxify: parse jwks key %q: point not on curve", k.Kid)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		default:
+			return nil, fmt.Errorf("muxify: parse jwks key %q: unsupported key type %q", k.Kid, k.Kty)
+		}
+	}
+
+	return keys, nil
+}
+
+// LoadJWKSFile reads and parses a JSON Web Key Set file.
+func LoadJWKSFile(path string) (KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("muxify: load jwks: %w", err)
+	}
+	return ParseJWKS(data)
+}
+
+// decodeBigInt decodes a base64url encoded big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// JWTOptions configures the JWTAuth middleware.
+type JWTOptions struct {
+	// Realm is sent in the WWW-Authenticate challenge.
+	Realm string
+	// Keys verify the token signatures.
+	Keys KeySet
+	// Issuer is the required "iss" claim. It is not checked if empty.
+	Issuer string
+	// Audience is a required entry of the "aud" claim. It is not checked if empty.
+	Audience string
+	// Leeway is the allowed clock skew when checking "exp" and "nbf".
+	Leeway time.Duration
+}
+
+// JWTAuth returns a middleware that requires a signed JWT as bearer token.
+// Supported algorithms are HS256, RS256 and ES256.
+// The principal carries the "sub" claim as subject, the "scope" or "scp"
+// claim as scopes, the "roles" claim as roles and all claims.
+func JWTAuth(opts JWTOptions) Middleware {
+	return BearerAuth(BearerAuthOptions{
+		Realm:    opts.Realm,
+		Validate: NewJWTValidator(opts),
+	})
+}
+
+// NewJWTValidator returns a TokenValidator for signed JWTs.
+// The Realm of the options is ignored.
+func NewJWTValidator(opts JWTOptions) TokenValidator {
+	return func(ctx context.Context, token string) (*Principal, error) {
+		return validateJWT(opts, token, time.Now())
+	}
+}
+
+// validateJWT verifies the signature and the claims of the token.
+func validateJWT(opts JWTOptions, token string, now time.Time) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("muxify: malformed jwt")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("muxify: malformed jwt header: %w", err)
+	}
+
+	key, ok := opts.Keys[header.Kid]
+	if !ok && header.Kid == "" && len(opts.Keys) == 1 {
+		for _, k := range opts.Keys {
+			key, ok = k, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("muxify: unknown jwt key %q", header.Kid)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("muxify: malformed jwt signature: %w", err)
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("muxify: malformed jwt claims: %w", err)
+	}
+
+	if exp, ok := claims["exp"].(float64); ok && !now.Before(time.Unix(int64(exp), 0).Add(opts.Leeway)) {
+		return nil, errors.New("muxify: jwt expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(opts.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("muxify: jwt not valid yet")
+	}
+	if opts.Issuer != "" && claims["iss"] != opts.Issuer {
+		return nil, errors.New("muxify: invalid jwt issuer")
+	}
+	if opts.Audience != "" && !slices.Contains(stringList(claims["aud"]), opts.Audience) {
+		return nil, errors.New("muxify: invalid jwt audience")
+	}
+
+	p := &Principal{
+		Scheme: "Bearer",
+		Roles:  stringList(claims["roles"]),
+		Claims: claims,
+	}
+	p.Subject, _ = claims["sub"].(string)
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	} else {
+		p.Scopes = stringList(claims["scp"])
+	}
+
+	return p, nil
+}
+
+// verifyJWTSignature verifies the signature of the signing input.
+// The algorithm must match the type of the key.
+func verifyJWTSignature(alg string, key any, signingInput string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			break
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errors.New("muxify: invalid jwt signature")
+		}
+		return nil
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return errors.New("muxify: invalid jwt signature")
+		}
+		return nil
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			break
+		}
+		if len(sig) != 64 {
+			return errors.New("muxify: invalid jwt signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return errors.New("muxify: invalid jwt signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("muxify: unsupported jwt algorithm %q for key", alg)
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT.
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// stringList converts a claim that is a string or a list of strings to a slice.
+func stringList(claim any) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package muxify_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_JWTAuth(t *testing.T) {
+	secret := []byte("muxify-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := muxify.KeySet{
+		"hs": secret,
+		"rs": &rsaKey.PublicKey,
+		"es": &ecKey.PublicKey,
+	}
+	now := time.Now().Unix()
+	valid := map[string]any{
+		"sub":   "luke",
+		"iss":   "muxify",
+		"aud":   []string{"api"},
+		"exp":   now + 60,
+		"scope": "users.read users.write",
+	}
+	with := func(k string, v any) map[string]any {
+		claims := map[string]any{}
+		for ck, cv := range valid {
+			claims[ck] = cv
+		}
+		claims[k] = v
+		return claims
+	}
+
+	testCases := map[string]struct {
+		token         string
+		expStatusCode int
+		expBody       string
+	}{
+		"ok - HS256": {
+			token:         signJWT(t, "HS256", "hs", secret, valid),
+			expStatusCode: http.StatusOK,
+			expBody:       "luke [users.read users.write]",
+		},
+		"ok - RS256": {
+			token:         signJWT(t, "RS256", "rs", rsaKey, valid),
+			expStatusCode: http.StatusOK,
+			expBody:       "luke [users.read users.write]",
+		},
+		"ok - ES256": {
+			token:         signJWT(t, "ES256", "es", ecKey, valid),
+			expStatusCode: http.StatusOK,
+			expBody:       "luke [users.read users.write]",
+		},
+		"ok - expired within leeway": {
+			token:         signJWT(t, "HS256", "hs", secret, with("exp", now-10)),
+			expStatusCode: http.StatusOK,
+			expBody:       "luke [users.read users.write]",
+		},
+		"expired": {
+			token:         signJWT(t, "HS256", "hs", secret, with("exp", now-60)),
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"not valid yet": {
+			token:         signJWT(t, "HS256", "hs", secret, with("nbf", now+60)),
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"wrong issuer": {
+			token:         signJWT(t, "HS256", "hs", secret, with("iss", "vader")),
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"wrong audience": {
+			token:         signJWT(t, "HS256", "hs", secret, with("aud", "admin")),
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"unknown key": {
+			token:         signJWT(t, "HS256", "unknown", secret, valid),
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"algorithm does not match key": {
+			token:         signJWT(t, "HS256", "rs", secret, valid),
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"invalid signature": {
+			token:         signJWT(t, "HS256", "hs", []byte("wrong"), valid),
+			expStatusCode: http.StatusUnauthorized,
+		},
+		"malformed": {
+			token:         "not.a-jwt",
+			expStatusCode: http.StatusUnauthorized,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			mux := muxify.NewMux()
+			mux.Use(muxify.JWTAuth(muxify.JWTOptions{
+				Keys:     keys,
+				Issuer:   "muxify",
+				Audience: "api",
+				Leeway:   30 * time.Second,
+			}))
+			mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+				p := muxify.RequestPrincipal(r)
+				_, _ = w.Write([]byte(p.Subject + " [" + strings.Join(p.Scopes, " ") + "]"))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if tc.expBody != "" && rec.Body.String() != tc.expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_LoadJWKSFile(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": b64([]byte("muxify-secret"))},
+		{"kty": "RSA", "kid": "rs", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "es", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := muxify.LoadJWKSFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validate := muxify.NewJWTValidator(muxify.JWTOptions{Keys: keys})
+	tokens := map[string]string{
+		"hs": signJWT(t, "HS256", "hs", []byte("muxify-secret"), map[string]any{"sub": "hs"}),
+		"rs": signJWT(t, "RS256", "rs", rsaKey, map[string]any{"sub": "rs"}),
+		"es": signJWT(t, "ES256", "es", ecKey, map[string]any{"sub": "es"}),
+	}
+	for kid, token := range tokens {
+		p, err := validate(context.Background(), token)
+		if err != nil {
+			t.Fatalf("%s: %v", kid, err)
+		}
+		if p.Subject != kid {
+			t.Errorf("\nwant: %v\ngot: %v\n", kid, p.Subject)
+		}
+	}
+
+	if _, err := muxify.ParseJWKS([]byte(`{"keys":[{"kty":"OKP","kid":"ed"}]}`)); err == nil {
+		t.Errorf("no error for unsupported key type")
+	}
+}
+
+// signJWT signs the claims with the given algorithm and key.
+func signJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signingInput := enc(map[string]string{"alg": alg, "typ": "JWT", "kid": kid}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signingInput))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
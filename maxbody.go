@@ -0,0 +1,86 @@
+package muxify
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// MaxBody returns a middleware that limits request bodies to n bytes.
+// Requests with a larger Content-Length are answered with 413 Request Entity Too Large
+// before the handler runs, otherwise reading beyond the limit fails with an *http.MaxBytesError.
+//
+// A MaxBody middleware used on a subrouter replaces the limit of its parent
+// and a limit set with Route.MaxBody replaces both, so an upload subrouter
+// can allow more than the rest of the API. The limit is fixed when the body
+// is first read, e.g. by a middleware between two MaxBody middlewares.
+func MaxBody(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// an inner limit replaces an outer one
+			if b, ok := r.Context().Value(bodyKey).(*bodyLimit); ok {
+				b.limit = n
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			body := r.Body
+			if body == nil {
+				body = http.NoBody
+			}
+			b := &bodyLimit{limit: n, route: CurrentRoute(r), w: w, body: body}
+			r = r.WithContext(context.WithValue(r.Context(), bodyKey, b))
+			r.Body = b
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bodyLimit is the request body limited by the innermost MaxBody
+// middleware or the route.
+type bodyLimit struct {
+	limit int64
+	route *Route
+	w     http.ResponseWriter
+	body  io.ReadCloser
+	// reader is the limited body, created on the first read.
+	reader io.ReadCloser
+}
+
+// max returns the effective limit.
+func (b *bodyLimit) max() int64 {
+	if n := b.route.bodyLimit(); n > 0 {
+		return n
+	}
+	return b.limit
+}
+
+func (b *bodyLimit) Read(p []byte) (int, error) {
+	if b.reader == nil {
+		b.reader = http.MaxBytesReader(b.w, b.body, b.max())
+	}
+	return b.reader.Read(p)
+}
+
+func (b *bodyLimit) Close() error {
+	return b.body.Close()
+}
+
+// checkBodyLimit returns an http.Handler that answers requests with a
+// Content-Length beyond the limit of the MaxBody middlewares with
+// 413 Request Entity Too Large. It wraps the handler of a route,
+// so all middlewares had the chance to replace the limit.
+func checkBodyLimit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b, ok := r.Context().Value(bodyKey).(*bodyLimit); ok {
+			// a rewritten request reaches another route
+			b.route = CurrentRoute(r)
+			if r.ContentLength > b.max() {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
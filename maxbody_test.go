@@ -0,0 +1,101 @@
+package muxify_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_MaxBody(t *testing.T) {
+	read := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		_, _ = w.Write(body)
+	}
+
+	mux := muxify.NewMux()
+	mux.Use(muxify.MaxBody(4))
+	mux.HandleFunc("POST /api", read)
+	mux.HandleFunc("POST /api/import", read).MaxBody(8)
+
+	uploads := mux.Subrouter().Prefix("/uploads")
+	uploads.Use(muxify.MaxBody(16))
+	uploads.HandleFunc("POST /", read)
+
+	testCases := map[string]struct {
+		path          string
+		body          string
+		chunked       bool
+		expStatusCode int
+	}{
+		"ok - below limit": {
+			path:          "/api",
+			body:          "1234",
+			expStatusCode: http.StatusOK,
+		},
+		"content length too large": {
+			path:          "/api",
+			body:          "12345",
+			expStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		"chunked body too large": {
+			path:          "/api",
+			body:          "12345",
+			chunked:       true,
+			expStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		"ok - route override": {
+			path:          "/api/import",
+			body:          "12345678",
+			expStatusCode: http.StatusOK,
+		},
+		"route override too large": {
+			path:          "/api/import",
+			body:          "123456789",
+			chunked:       true,
+			expStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		"ok - subrouter override": {
+			path:          "/uploads/",
+			body:          strings.Repeat("1", 16),
+			expStatusCode: http.StatusOK,
+		},
+		"subrouter override too large": {
+			path:          "/uploads/",
+			body:          strings.Repeat("1", 17),
+			expStatusCode: http.StatusRequestEntityTooLarge,
+		},
+		"subrouter override chunked body too large": {
+			path:          "/uploads/",
+			body:          strings.Repeat("1", 17),
+			chunked:       true,
+			expStatusCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if tc.expStatusCode == http.StatusOK && rec.Body.String() != tc.body {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.body, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package muxify
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the default request duration histogram buckets in seconds.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the default response size histogram buckets in bytes.
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7, 1e8}
+
+// MetricsOptions configures Metrics.
+type MetricsOptions struct {
+	// Namespace prefixes the metric names. Defaults to "http".
+	Namespace string
+	// DurationBuckets are the upper bounds of the request duration histogram in seconds.
+	// Defaults to DefaultDurationBuckets.
+	DurationBuckets []float64
+	// SizeBuckets are the upper bounds of the response size histogram in bytes.
+	// Defaults to DefaultSizeBuckets.
+	SizeBuckets []float64
+}
+
+// Metrics collects request metrics labeled by method, registered pattern
+// and status class and exposes them in the Prometheus text format.
+// Labeling by registered pattern instead of the raw path keeps the
+// number of series bounded.
+type Metrics struct {
+	namespace       string
+	durationBuckets []float64
+	sizeBuckets     []float64
+
+	mu        sync.Mutex
+	requests  map[metricLabels]uint64
+	durations map[metricLabels]*histogram
+	sizes     map[metricLabels]*histogram
+	inFlight  map[metricLabels]int64
+}
+
+// metricLabels are the labels of a series.
+// The status is empty for in-flight requests.
+type metricLabels struct {
+	method  string
+	pattern string
+	status  string
+}
+
+// histogram is a cumulative histogram.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewMetrics returns new Metrics.
+func NewMetrics(opts MetricsOptions) *Metrics {
+	if opts.Namespace == "" {
+		opts.Namespace = "http"
+	}
+	if opts.DurationBuckets == nil {
+		opts.DurationBuckets = DefaultDurationBuckets
+	}
+	if opts.SizeBuckets == nil {
+		opts.SizeBuckets = DefaultSizeBuckets
+	}
+
+	return &Metrics{
+		namespace:       opts.Namespace,
+		durationBuckets: sortedCopy(opts.DurationBuckets),
+		sizeBuckets:     sortedCopy(opts.SizeBuckets),
+		requests:        make(map[metricLabels]uint64),
+		durations:       make(map[metricLabels]*histogram),
+		sizes:           make(map[metricLabels]*histogram),
+		inFlight:        make(map[metricLabels]int64),
+	}
+}
+
+// Middleware returns a middleware that records the metrics of each request.
+func (m *Metrics) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, pattern := splitPattern(RoutePattern(r))
+			method := metricMethod(r.Method)
+			flight := metricLabels{method: method, pattern: pattern}
+
+			m.mu.Lock()
+			m.inFlight[flight]++
+			m.mu.Unlock()
+
+			start := time.Now()
+			rw := WrapResponseWriter(w)
+			defer func() {
+				p := recover()
+				status := rw.Status()
+				switch {
+				case p != nil:
+					// the server answers a panicking handler with an error
+					status = http.StatusInternalServerError
+				case status == 0:
+					status = http.StatusOK
+				}
+				labels := metricLabels{method: method, pattern: pattern, status: strconv.Itoa(status/100) + "xx"}
+
+				m.mu.Lock()
+				m.inFlight[flight]--
+				m.requests[labels]++
+				m.observe(m.durations, m.durationBuckets, labels, time.Since(start).Seconds())
+				m.observe(m.sizes, m.sizeBuckets, labels, float64(rw.BytesWritten()))
+				m.mu.Unlock()
+
+				if p != nil {
+					panic(p)
+				}
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// metricMethod returns the method label of a request.
+// Non-standard methods share one label to bound the number of series.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// observe adds the value to the histogram of the labels.
+func (m *Metrics) observe(histograms map[metricLabels]*histogram, buckets []float64, labels metricLabels, v float64) {
+	h, ok := histograms[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(buckets))}
+		histograms[labels] = h
+	}
+	for i, upper := range buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Handler returns an http.Handler that exposes the metrics
+// in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = m.WriteTo(w)
+	})
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format to w.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	ns := m.namespace
+
+	fmt.Fprintf(&b, "# HELP %s_requests_total Total number of HTTP requests.\n", ns)
+	fmt.Fprintf(&b, "# TYPE %s_requests_total counter\n", ns)
+	for _, labels := range sortedLabels(m.requests) {
+		fmt.Fprintf(&b, "%s_requests_total%s %d\n", ns, labels.format(""), m.requests[labels])
+	}
+
+	fmt.Fprintf(&b, "# HELP %s_requests_in_flight Number of HTTP requests being served.\n", ns)
+	fmt.Fprintf(&b, "# TYPE %s_requests_in_flight gauge\n", ns)
+	for _, labels := range sortedLabels(m.inFlight) {
+		fmt.Fprintf(&b, "%s_requests_in_flight%s %d\n", ns, labels.format(""), m.inFlight[labels])
+	}
+
+	writeHistograms(&b, ns+"_request_duration_seconds", "Duration of HTTP requests in seconds.", m.durations, m.durationBuckets)
+	writeHistograms(&b, ns+"_response_size_bytes", "Size of HTTP responses in bytes.", m.sizes, m.sizeBuckets)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// writeHistograms writes the histograms of a metric in the text exposition format.
+func writeHistograms(b *strings.Builder, name, help string, histograms map[metricLabels]*histogram, buckets []float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s histogram\n", name)
+	for _, labels := range sortedLabels(histograms) {
+		h := histograms[labels]
+		for i, upper := range buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", name, labels.format(formatFloat(upper)), h.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", name, labels.format("+Inf"), h.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", name, labels.format(""), formatFloat(h.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", name, labels.format(""), h.count)
+	}
+}
+
+// format returns the labels in the text exposition format.
+// The le label is added if it is not empty.
+func (l metricLabels) format(le string) string {
+	pairs := []string{
+		`method="` + escapeLabel(l.method) + `"`,
+		`pattern="` + escapeLabel(l.pattern) + `"`,
+	}
+	if l.status != "" {
+		pairs = append(pairs, `status="`+l.status+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabel escapes a label value for the text exposition format.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatFloat formats a float for the text exposition format.
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedLabels returns the labels of a series map in a stable order.
+func sortedLabels[V any](series map[metricLabels]V) []metricLabels {
+	labels := make([]metricLabels, 0, len(series))
+	for l := range series {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].pattern != labels[j].pattern {
+			return labels[i].pattern < labels[j].pattern
+		}
+		if labels[i].method != labels[j].method {
+			return labels[i].method < labels[j].method
+		}
+		return labels[i].status < labels[j].status
+	})
+	return labels
+}
+
+// sortedCopy returns a sorted copy of the buckets.
+func sortedCopy(buckets []float64) []float64 {
+	c := append([]float64{}, buckets...)
+	sort.Float64s(c)
+	return c
+}
@@ -0,0 +1,117 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_Metrics(t *testing.T) {
+	metrics := muxify.NewMetrics(muxify.MetricsOptions{
+		Namespace:       "muxify",
+		DurationBuckets: []float64{60},
+		SizeBuckets:     []float64{5, 10},
+	})
+
+	mux := muxify.NewMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	api := mux.Subrouter().Prefix("/api")
+	api.Use(metrics.Middleware())
+	api.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("user " + r.PathValue("id")))
+	})
+	api.HandleFunc("POST /users", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/users/1", nil),
+		httptest.NewRequest(http.MethodGet, "/api/users/2", nil),
+		httptest.NewRequest(http.MethodPost, "/api/users", nil),
+	} {
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("\nwant: %v\ngot: %v\n", "text/plain; version=0.0.4", got)
+	}
+
+	expLines := []string{
+		"# TYPE muxify_requests_total counter",
+		`muxify_requests_total{method="GET",pattern="/api/users/{id}",status="2xx"} 2`,
+		`muxify_requests_total{method="POST",pattern="/api/users",status="5xx"} 1`,
+		"# TYPE muxify_requests_in_flight gauge",
+		`muxify_requests_in_flight{method="GET",pattern="/api/users/{id}"} 0`,
+		"# TYPE muxify_request_duration_seconds histogram",
+		`muxify_request_duration_seconds_bucket{method="GET",pattern="/api/users/{id}",status="2xx",le="60"} 2`,
+		`muxify_request_duration_seconds_bucket{method="GET",pattern="/api/users/{id}",status="2xx",le="+Inf"} 2`,
+		`muxify_request_duration_seconds_count{method="GET",pattern="/api/users/{id}",status="2xx"} 2`,
+		"# TYPE muxify_response_size_bytes histogram",
+		`muxify_response_size_bytes_bucket{method="GET",pattern="/api/users/{id}",status="2xx",le="5"} 0`,
+		`muxify_response_size_bytes_bucket{method="GET",pattern="/api/users/{id}",status="2xx",le="10"} 2`,
+		`muxify_response_size_bytes_sum{method="GET",pattern="/api/users/{id}",status="2xx"} 12`,
+		`muxify_response_size_bytes_bucket{method="POST",pattern="/api/users",status="5xx",le="5"} 1`,
+	}
+	body := rec.Body.String()
+	for _, line := range expLines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing line: %s\ngot:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "/metrics") {
+		t.Errorf("unmeasured route in metrics:\n%s", body)
+	}
+}
+
+func Test_Metrics_InFlight(t *testing.T) {
+	metrics := muxify.NewMetrics(muxify.MetricsOptions{})
+
+	mux := muxify.NewMux()
+	mux.Use(metrics.Middleware())
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		_, _ = metrics.WriteTo(&b)
+		_, _ = w.Write([]byte(b.String()))
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := `http_requests_in_flight{method="GET",pattern="/"} 1`
+	if !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("missing line: %s\ngot:\n%s", want, rec.Body.String())
+	}
+}
+
+func Test_Metrics_Panic(t *testing.T) {
+	metrics := muxify.NewMetrics(muxify.MetricsOptions{})
+
+	mux := muxify.NewMux()
+	mux.Use(metrics.Middleware())
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	func() {
+		defer func() {
+			if got := recover(); got != "boom" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "boom", got)
+			}
+		}()
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	var b strings.Builder
+	_, _ = metrics.WriteTo(&b)
+	want := `http_requests_total{method="GET",pattern="/",status="5xx"} 1`
+	if !strings.Contains(b.String(), want) {
+		t.Errorf("missing line: %s\ngot:\n%s", want, b.String())
+	}
+}
@@ -7,96 +7,470 @@
 package muxify
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
 )
 
 // Mux is a simple wrapper for the http.ServeMux.
+// Its methods are safe for concurrent use.
 type Mux struct {
-	muxify             *http.ServeMux
-	patternPrefix      string
-	middlewares        []Middleware
-	registeredPatterns *[]string
+	mu            sync.Mutex
+	patternPrefix string
+	middlewares   []namedMiddleware
+	tree          *tree
+	err           error
+	// batch collects the registrations of the mux passed to Update.
+	batch *batch
 }
 
+// tree is the state a mux shares with all its sub muxes.
+type tree struct {
+	opts options
+
+	mu     sync.Mutex
+	routes []*Route
+	// serveMux is the http.ServeMux built from the routes.
+	// It is replaced when routes are removed.
+	serveMux atomic.Pointer[http.ServeMux]
+	// sealed is set by Seal and the first ServeHTTP.
+	sealed atomic.Bool
+
+	pre []Middleware
+	// dispatch is the http.ServeMux wrapped with the path normalization.
+	dispatch http.Handler
+	// handler is dispatch wrapped with the pre middlewares.
+	handler http.Handler
+}
+
+// namedMiddleware is a middleware used on a mux.
+// The name is empty for middlewares without a name.
+type namedMiddleware struct {
+	name       string
+	middleware Middleware
+}
+
+// ErrSealed is the panic value of registering on a sealed mux.
+var ErrSealed = errors.New("muxify: mux is sealed, register before serving or within Update")
+
 // Middleware represents an http.Handler wrapper to inject additional functionality.
 type Middleware func(http.Handler) http.Handler
 
 // NewMux returns a new muxify.Mux.
 // This is a simple wrapper for the http.ServeMux.
-func NewMux() *Mux {
-	s := make([]string, 0)
-	return &Mux{
-		muxify:             http.NewServeMux(),
-		registeredPatterns: &s,
+// Options configure the path normalization applied before dispatching.
+func NewMux(opts ...Option) *Mux {
+	mux := &Mux{
+		tree: &tree{},
 	}
+	for _, opt := range opts {
+		opt(&mux.tree.opts)
+	}
+	mux.tree.serveMux.Store(http.NewServeMux())
+	mux.tree.dispatch = mux.dispatcher()
+	mux.tree.handler = mux.tree.dispatch
+	return mux
 }
 
 // Handle wraps the http.Handle func.
 // It wraps the pattern with prefixes
 // and the handler with middlewares.
-func (mux *Mux) Handle(pattern string, handler http.Handler) {
+// The returned route can be annotated with requirements.
+// It panics if the mux has an invalid prefix or with ErrSealed
+// if the mux is sealed.
+func (mux *Mux) Handle(pattern string, handler http.Handler) *Route {
+	mux.mu.Lock()
+	prefix, mws, err := mux.patternPrefix, mux.handlerMiddlewares(), mux.err
+	mux.mu.Unlock()
+	if err != nil {
+		panic(err)
+	}
+	mux.checkOpen()
+
 	method, patternPath := splitPattern(pattern)
-	pattern = method + mux.patternPrefix + patternPath
-	mux.muxify.Handle(
-		pattern,
-		newHandler(mux.middlewares...)(handler),
-	)
-	*mux.registeredPatterns = append(*mux.registeredPatterns, pattern)
+	route := &Route{pattern: method + prefix + patternPath}
+	route.handler = withRoute(route, route.wrap(mws, checkBodyLimit(handler)))
+	if b := mux.batch; b != nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.added = append(b.added, route)
+		return route
+	}
+	mux.tree.add(route)
+	return route
 }
 
 // HandleFunc wraps the http.HandleFunc func.
 // It wraps the pattern with prefixes
 // and the handler with middlewares.
-func (mux *Mux) HandleFunc(pattern string, handlerFunc func(http.ResponseWriter, *http.Request)) {
-	method, patternPath := splitPattern(pattern)
-	pattern = method + mux.patternPrefix + patternPath
-	mux.muxify.Handle(
-		pattern,
-		newHandler(mux.middlewares...)(http.HandlerFunc(handlerFunc)),
-	)
-	*mux.registeredPatterns = append(*mux.registeredPatterns, pattern)
+// The returned route can be annotated with requirements.
+func (mux *Mux) HandleFunc(pattern string, handlerFunc func(http.ResponseWriter, *http.Request)) *Route {
+	return mux.Handle(pattern, http.HandlerFunc(handlerFunc))
 }
 
 // Subrouter returns a sub mux.
+// Middlewares used on the sub mux do not leak into the mux or sibling sub muxes.
 func (mux *Mux) Subrouter() *Mux {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
 	return &Mux{
-		muxify:             mux.muxify,
-		patternPrefix:      mux.patternPrefix,
-		middlewares:        mux.middlewares,
-		registeredPatterns: mux.registeredPatterns,
+		patternPrefix: mux.patternPrefix,
+		middlewares:   slices.Clip(mux.middlewares),
+		tree:          mux.tree,
+		err:           mux.err,
+		batch:         mux.batch,
 	}
 }
 
 // Use wraps a middleware to the mux.
+// It panics with ErrSealed if the mux is sealed.
 func (mux *Mux) Use(middleware ...Middleware) {
-	mux.middlewares = append(mux.middlewares, middleware...)
+	mux.checkOpen()
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	for _, mw := range middleware {
+		mux.middlewares = append(mux.middlewares, namedMiddleware{middleware: mw})
+	}
+}
+
+// UseNamed wraps a middleware with a name to the mux.
+// Sub muxes can opt out of it with Without and routes with Route.Skip.
+// It panics with ErrSealed if the mux is sealed.
+func (mux *Mux) UseNamed(name string, middleware Middleware) {
+	mux.checkOpen()
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	mux.middlewares = append(mux.middlewares, namedMiddleware{
+		name:       name,
+		middleware: skippable(name, middleware),
+	})
+}
+
+// Without removes the named middlewares the mux inherited or uses,
+// e.g. mux.Subrouter().Without("auth") for a health check.
+// Middlewares used afterwards are not affected.
+func (mux *Mux) Without(names ...string) *Mux {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	mux.middlewares = slices.DeleteFunc(slices.Clone(mux.middlewares), func(m namedMiddleware) bool {
+		return m.name != "" && slices.Contains(names, m.name)
+	})
+	return mux
+}
+
+// handlerMiddlewares returns the middlewares a handler is wrapped with.
+func (mux *Mux) handlerMiddlewares() []Middleware {
+	mws := make([]Middleware, len(mux.middlewares))
+	for i, m := range mux.middlewares {
+		mws[i] = m.middleware
+	}
+	return mws
+}
+
+// Pre wraps middlewares around the mux itself. Unlike middlewares added
+// with Use they run before the route is matched, so they also apply to
+// not found and method not allowed responses and redirects of the
+// http.ServeMux, e.g. logging or request IDs. They can't see the route.
+// Pre middlewares are global: calling Pre on a sub mux adds them to the root mux.
+// It panics with ErrSealed if the mux is sealed, also within Update.
+func (mux *Mux) Pre(middleware ...Middleware) {
+	t := mux.tree
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sealed.Load() {
+		panic(ErrSealed)
+	}
+	t.pre = append(t.pre, middleware...)
+	t.handler = newHandler(t.pre...)(t.dispatch)
+}
+
+// dispatcher returns the http.Handler that dispatches requests
+// to the registered routes.
+func (mux *Mux) dispatcher() http.Handler {
+	if mux.tree.opts.enabled() {
+		return mux.normalize()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.tree.serveMux.Load().ServeHTTP(w, r)
+	})
 }
 
 // Prefix sets a prefix for the mux.
+// The prefix is cleaned: a missing leading slash is added,
+// duplicate and trailing slashes are removed.
+// Wildcards are allowed as whole segments, e.g. "/tenants/{tenant}",
+// and handlers read them with PathValue.
+// An invalid prefix is reported by Err and makes Handle panic.
 func (mux *Mux) Prefix(prefix string) *Mux {
-	if len(prefix) > 0 {
-		if prefix[0] != '/' {
-			prefix = "/" + prefix
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	clean, err := cleanPrefix(mux.patternPrefix, prefix)
+	if err != nil {
+		if mux.err == nil {
+			mux.err = err
 		}
+		return mux
 	}
 
-	mux.patternPrefix += prefix
+	mux.patternPrefix += clean
 	return mux
 }
 
-// PrintRegisteredPatterns prints the registered patterns of the http.ServeMux.
-// The Build() method needs to be called before!
+// Err returns the error of the first invalid prefix
+// of the mux or its parent muxes.
+func (mux *Mux) Err() error {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	return mux.err
+}
+
+// prefix returns the pattern prefix of the mux.
+func (mux *Mux) prefix() string {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	return mux.patternPrefix
+}
+
+// Routes returns the routes registered on the mux and all its sub muxes.
+func (mux *Mux) Routes() []*Route {
+	mux.tree.mu.Lock()
+	defer mux.tree.mu.Unlock()
+	return slices.Clone(mux.tree.routes)
+}
+
+// Seal freezes the registration: Handle, Use, UseNamed and Pre
+// (and the helpers registering routes) panic with ErrSealed afterwards,
+// only Update and Remove change the routes while serving.
+// The mux is sealed by its first ServeHTTP at the latest.
+func (mux *Mux) Seal() {
+	t := mux.tree
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sealed.Store(true)
+}
+
+// checkOpen panics with ErrSealed if the mux is sealed
+// and the registration is not part of an Update.
+func (mux *Mux) checkOpen() {
+	if mux.batch == nil && mux.tree.sealed.Load() {
+		panic(ErrSealed)
+	}
+}
+
+// Remove removes routes of the mux or its sub muxes. The http.ServeMux
+// is rebuilt from the remaining routes and swapped atomically: requests
+// in flight finish on the old one, new requests are dispatched by the new one.
+// It is safe to call while the mux serves requests.
+// Within Update, the routes are removed when the update is applied.
+func (mux *Mux) Remove(routes ...*Route) {
+	// don't append to the array of the caller
+	routes = slices.Clip(routes)
+	for _, route := range routes {
+		routes = append(routes, route.linked...)
+	}
+	if b := mux.batch; b != nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.removed = append(b.removed, routes...)
+		return
+	}
+
+	t := mux.tree
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	remaining := slices.DeleteFunc(slices.Clone(t.routes), func(route *Route) bool {
+		return slices.Contains(routes, route)
+	})
+	t.serveMux.Store(newServeMux(remaining))
+	t.routes = remaining
+}
+
+// Update applies the routes registered and removed by f at once, e.g. to
+// replace the routes of a feature toggle or plugin without requests seeing
+// a state in between. f registers and removes them on the given mux (or its
+// sub muxes), which has the prefix and the middlewares of the mux. The
+// http.ServeMux is rebuilt and swapped like in Remove.
+// Routes can be registered within f even if the mux is sealed.
+// If f panics or a pattern conflicts, no change is applied and the panic
+// is passed on. An Update within f is part of the outer one.
+func (mux *Mux) Update(f func(mux *Mux)) {
+	if mux.batch != nil {
+		f(mux.Subrouter())
+		return
+	}
+
+	staging := mux.Subrouter()
+	staging.batch = &batch{}
+	f(staging)
+
+	b := staging.batch
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := mux.tree
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	routes := slices.DeleteFunc(slices.Clone(t.routes), func(route *Route) bool {
+		return slices.Contains(b.removed, route)
+	})
+	routes = append(routes, b.added...)
+	t.serveMux.Store(newServeMux(routes))
+	t.routes = routes
+}
+
+// batch collects the routes registered and removed within an Update.
+type batch struct {
+	mu      sync.Mutex
+	added   []*Route
+	removed []*Route
+}
+
+// add adds a route. It is registered on the current http.ServeMux,
+// which panics if the pattern conflicts.
+func (t *tree) add(route *Route) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sealed.Load() {
+		panic(ErrSealed)
+	}
+	t.serveMux.Load().Handle(route.pattern, route.handler)
+	t.routes = append(t.routes, route)
+}
+
+// newServeMux builds an http.ServeMux from the routes.
+// It panics if a pattern conflicts.
+func newServeMux(routes []*Route) *http.ServeMux {
+	sm := http.NewServeMux()
+	for _, route := range routes {
+		sm.Handle(route.pattern, route.handler)
+	}
+	return sm
+}
+
+// PrintRegisteredPatterns prints the registered patterns of the http.ServeMux
+// together with their requirements.
 func (mux *Mux) PrintRegisteredPatterns() {
 	fmt.Println("* Registered patterns:", strings.Repeat("*", 47))
-	fmt.Println(strings.Join(*mux.registeredPatterns, "\n"))
+	for _, route := range mux.Routes() {
+		fmt.Println(route)
+	}
 	fmt.Printf("%s\n\n", strings.Repeat("*", 70))
 }
 
 // Implement http.Handler interface.
 func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	mux.muxify.ServeHTTP(w, r)
+	if !mux.tree.sealed.Load() {
+		mux.Seal()
+	}
+	mux.tree.handler.ServeHTTP(w, r)
+}
+
+// contextKey is the type of the keys muxify stores in a request context.
+type contextKey int
+
+const (
+	routeKey contextKey = iota
+	principalKey
+	csrfTokenKey
+	cspNonceKey
+	clientIPKey
+	bodyKey
+	spanKey
+	rewriteKey
+	originalPathKey
+)
+
+// RoutePattern returns the registered pattern (prefixes included)
+// that matched the request or an empty string if there is none.
+func RoutePattern(r *http.Request) string {
+	if route := CurrentRoute(r); route != nil {
+		return route.pattern
+	}
+	return ""
+}
+
+// CurrentRoute returns the registered route that matched the request
+// or nil if there is none.
+func CurrentRoute(r *http.Request) *Route {
+	route, _ := r.Context().Value(routeKey).(*Route)
+	return route
+}
+
+// withRoute returns an http.Handler that stores the registered route
+// in the request context before calling the handler.
+func withRoute(route *Route, h http.Handler) http.Handler {
+	return &routeHandler{route: route, handler: h}
+}
+
+// routeHandler is the http.Handler registered for a route.
+type routeHandler struct {
+	route   *Route
+	handler http.Handler
+}
+
+func (rh *routeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	restorePathValues(r, rh.route)
+	rh.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeKey, rh.route)))
+}
+
+// skippable returns a middleware that is bypassed
+// for routes that skip the name.
+func skippable(name string, mw Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return forwardRegistrar(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := CurrentRoute(r); route != nil && route.skips(name) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			wrapped.ServeHTTP(w, r)
+		}), wrapped)
+	}
+}
+
+// routeRegistrar is implemented by handlers of middlewares that want to
+// know the routes they are registered for, e.g. to show up in the route listing.
+type routeRegistrar interface {
+	registerRoute(route *Route)
+}
+
+// wrap returns h wrapped with the middlewares of the route
+// and registers the route on the handlers of the middlewares.
+func (route *Route) wrap(mws []Middleware, h http.Handler) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+		if rr, ok := h.(routeRegistrar); ok {
+			rr.registerRoute(route)
+		}
+	}
+	return h
+}
+
+// forwardRegistrar returns h, which wraps the handler of a middleware,
+// registering routes like the wrapped handler.
+func forwardRegistrar(h, wrapped http.Handler) http.Handler {
+	if rr, ok := wrapped.(routeRegistrar); ok {
+		return struct {
+			http.Handler
+			routeRegistrar
+		}{h, rr}
+	}
+	return h
 }
 
 // newHandler returns an http.Handler wrapped with given middlewares.
@@ -109,6 +483,88 @@ func newHandler(mw ...Middleware) func(http.Handler) http.Handler {
 	}
 }
 
+// cleanPrefix cleans and validates a prefix
+// that is appended to the parent prefix.
+func cleanPrefix(parent, prefix string) (string, error) {
+	names := wildcardNames(parent)
+
+	var segments []string
+	for _, seg := range strings.Split(prefix, "/") {
+		if seg == "" {
+			continue
+		}
+		if err := validatePrefixSegment(seg); err != nil {
+			return "", fmt.Errorf("muxify: invalid prefix %q: %w", prefix, err)
+		}
+		if strings.HasPrefix(seg, "{") {
+			name := seg[1 : len(seg)-1]
+			if slices.Contains(names, name) {
+				return "", fmt.Errorf("muxify: invalid prefix %q: duplicate wildcard %q", prefix, name)
+			}
+			names = append(names, name)
+		}
+		segments = append(segments, seg)
+	}
+
+	if len(segments) == 0 {
+		return "", nil
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// validatePrefixSegment validates a segment of a prefix.
+func validatePrefixSegment(seg string) error {
+	if seg == "." || seg == ".." {
+		return errors.New("dot segment")
+	}
+	for _, c := range seg {
+		if unicode.IsSpace(c) || unicode.IsControl(c) || c == '?' || c == '#' {
+			return fmt.Errorf("invalid character %q", c)
+		}
+	}
+	if !strings.ContainsAny(seg, "{}") {
+		return nil
+	}
+
+	if seg[0] != '{' || seg[len(seg)-1] != '}' {
+		return errors.New("wildcard must be a whole segment")
+	}
+	name := seg[1 : len(seg)-1]
+	if name == "$" || strings.HasSuffix(name, "...") {
+		return fmt.Errorf("wildcard %q not allowed in a prefix", seg)
+	}
+	if !isIdentifier(name) {
+		return fmt.Errorf("invalid wildcard name %q", name)
+	}
+	return nil
+}
+
+// wildcardNames returns the names of the wildcards of a clean prefix
+// or a pattern path.
+func wildcardNames(p string) []string {
+	var names []string
+	for _, seg := range strings.Split(p, "/") {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") && seg != "{$}" {
+			names = append(names, strings.TrimSuffix(seg[1:len(seg)-1], "..."))
+		}
+	}
+	return names
+}
+
+// isIdentifier reports whether s is a Go identifier,
+// as required for wildcard names by the http.ServeMux.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !unicode.IsLetter(c) && c != '_' && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
 // splitPattern helps splitting the pattern "GET /a/b"
 // more specifically the method from the path and
 // returns both as a string.
@@ -88,8 +88,10 @@ func testMiddleware3(next http.Handler) http.Handler {
 
 func Test_Prefix(t *testing.T) {
 	testCases := map[string]struct {
-		prefix    string
-		expPrefix string
+		parentPrefix string
+		prefix       string
+		expPrefix    string
+		expErr       bool
 	}{
 		"ok - no slash prefix": {
 			prefix:    "a",
@@ -99,19 +101,75 @@ func Test_Prefix(t *testing.T) {
 			prefix:    "/a",
 			expPrefix: "/v1/a",
 		},
-		"ok - let go compiler handle": {
+		"ok - duplicate slashes": {
 			prefix:    "//a",
-			expPrefix: "/v1//a",
+			expPrefix: "/v1/a",
+		},
+		"ok - trailing slash": {
+			prefix:    "/a/",
+			expPrefix: "/v1/a",
+		},
+		"ok - slash only": {
+			prefix:    "/",
+			expPrefix: "/v1",
+		},
+		"ok - wildcard": {
+			prefix:    "/tenants/{tenant}",
+			expPrefix: "/v1/tenants/{tenant}",
 		},
 		"ok - empty": {
 			prefix:    "",
 			expPrefix: "/v1",
 		},
+		"space": {
+			prefix:    "/a b",
+			expPrefix: "/v1",
+			expErr:    true,
+		},
+		"query": {
+			prefix:    "/a?b",
+			expPrefix: "/v1",
+			expErr:    true,
+		},
+		"dot segment": {
+			prefix:    "/a/../b",
+			expPrefix: "/v1",
+			expErr:    true,
+		},
+		"partial wildcard": {
+			prefix:    "/a{b}",
+			expPrefix: "/v1",
+			expErr:    true,
+		},
+		"multi wildcard": {
+			prefix:    "/{rest...}",
+			expPrefix: "/v1",
+			expErr:    true,
+		},
+		"end wildcard": {
+			prefix:    "/{$}",
+			expPrefix: "/v1",
+			expErr:    true,
+		},
+		"invalid wildcard name": {
+			prefix:    "/{1a}",
+			expPrefix: "/v1",
+			expErr:    true,
+		},
+		"duplicate wildcard": {
+			parentPrefix: "/{version}",
+			prefix:       "/{version}",
+			expPrefix:    "/{version}",
+			expErr:       true,
+		},
 	}
 	for tname, tc := range testCases {
 		t.Run(tname, func(t *testing.T) {
+			if tc.parentPrefix == "" {
+				tc.parentPrefix = "/v1"
+			}
 			mux := Mux{
-				patternPrefix: "/v1",
+				patternPrefix: tc.parentPrefix,
 			}
 
 			mux.Prefix(tc.prefix)
@@ -127,6 +185,9 @@ func Test_Prefix(t *testing.T) {
 			if got != tc.expPrefix {
 				t.Errorf("\nwant: %v\ngot: %v\n", tc.expPrefix, got)
 			}
+			if gotErr := mux.Err() != nil; gotErr != tc.expErr {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expErr, mux.Err())
+			}
 		})
 	}
 }
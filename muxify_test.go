@@ -5,9 +5,11 @@
 package muxify_test
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 
 	"github.com/42LM/muxify"
@@ -509,3 +511,576 @@ func testMiddleware4(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+func Test_RoutePattern(t *testing.T) {
+	testCases := map[string]struct {
+		path       string
+		expPattern string
+	}{
+		"root": {
+			path:       "/",
+			expPattern: "GET /",
+		},
+		"prefixed": {
+			path:       "/a/b/123",
+			expPattern: "GET /a/b/{id}",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			var got string
+			mux := muxify.NewMux()
+			mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+				got = muxify.RoutePattern(r)
+			})
+			mux.Subrouter().Prefix("/a/b").HandleFunc("GET /{id}", func(w http.ResponseWriter, r *http.Request) {
+				got = muxify.RoutePattern(r)
+			})
+
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if got != tc.expPattern {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expPattern, got)
+			}
+		})
+	}
+}
+
+func Test_Subrouter_SiblingMiddlewares(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(testMiddleware1)
+	mux.Use(testMiddleware2)
+	mux.Use(testMiddleware3)
+
+	subMux1 := mux.Subrouter()
+	subMux2 := mux.Subrouter()
+	subMux1.Use(testMiddleware4)
+	subMux2.Use(testMiddleware1)
+
+	subMux1.HandleFunc("GET /a", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("a"))
+	})
+	subMux2.HandleFunc("GET /b", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("b"))
+	})
+
+	testCases := map[string]struct {
+		path    string
+		expBody string
+	}{
+		"subMux1": {
+			path:    "/a",
+			expBody: "MW1:MW2:MW3:MW4:a",
+		},
+		"subMux2": {
+			path:    "/b",
+			expBody: "MW1:MW2:MW3:MW1:b",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if got := rec.Body.String(); got != tc.expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBody, got)
+			}
+		})
+	}
+}
+
+func Test_NamedMiddlewares(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.UseNamed("log", testMiddleware1)
+	mux.UseNamed("auth", testMiddleware2)
+	mux.Use(testMiddleware3)
+
+	handler := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("GET /a", handler("a"))
+	mux.HandleFunc("GET /skip", handler("skip")).Skip("auth")
+
+	health := mux.Subrouter().Without("auth")
+	health.Use(testMiddleware4)
+	health.HandleFunc("GET /healthz", handler("healthz"))
+	health.HandleFunc("GET /quiet", handler("quiet")).Skip("log")
+
+	sibling := mux.Subrouter().Prefix("/sibling")
+	sibling.HandleFunc("GET /b", handler("b"))
+
+	testCases := map[string]struct {
+		path    string
+		expBody string
+	}{
+		"all middlewares": {
+			path:    "/a",
+			expBody: "MW1:MW2:MW3:a",
+		},
+		"route skips auth": {
+			path:    "/skip",
+			expBody: "MW1:MW3:skip",
+		},
+		"subrouter without auth": {
+			path:    "/healthz",
+			expBody: "MW1:MW3:MW4:healthz",
+		},
+		"subrouter without auth and route skips log": {
+			path:    "/quiet",
+			expBody: "MW3:MW4:quiet",
+		},
+		"sibling keeps auth": {
+			path:    "/sibling/b",
+			expBody: "MW1:MW2:MW3:b",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if got := rec.Body.String(); got != tc.expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBody, got)
+			}
+		})
+	}
+}
+
+func Test_Pre(t *testing.T) {
+	pre := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Pre", "true")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	mux := muxify.NewMux()
+	mux.Use(testMiddleware2)
+	mux.HandleFunc("GET /a", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("a"))
+	})
+	mux.HandleFunc("GET /dir/", func(w http.ResponseWriter, r *http.Request) {})
+
+	subMux := mux.Subrouter().Prefix("/sub")
+	subMux.Pre(pre)
+	subMux.HandleFunc("GET /b", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("b"))
+	})
+
+	testCases := map[string]struct {
+		method        string
+		path          string
+		expStatusCode int
+	}{
+		"matched route": {
+			method:        http.MethodGet,
+			path:          "/a",
+			expStatusCode: http.StatusOK,
+		},
+		"matched sub route": {
+			method:        http.MethodGet,
+			path:          "/sub/b",
+			expStatusCode: http.StatusOK,
+		},
+		"not found": {
+			method:        http.MethodGet,
+			path:          "/missing",
+			expStatusCode: http.StatusNotFound,
+		},
+		"method not allowed": {
+			method:        http.MethodPost,
+			path:          "/a",
+			expStatusCode: http.StatusMethodNotAllowed,
+		},
+		"redirect": {
+			method:        http.MethodGet,
+			path:          "/dir",
+			expStatusCode: http.StatusTemporaryRedirect,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if rec.Header().Get("X-Pre") != "true" {
+				t.Errorf("\nwant: pre middleware applied\ngot: %v\n", rec.Header())
+			}
+		})
+	}
+}
+
+func Test_Prefix_Wildcard(t *testing.T) {
+	mux := muxify.NewMux()
+	tenant := mux.Subrouter().Prefix("/tenants/{tenant}/")
+	tenant.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.PathValue("tenant") + ":" + r.PathValue("id")))
+	})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tenants/acme/users/1", nil))
+
+	if got := rec.Body.String(); got != "acme:1" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "acme:1", got)
+	}
+	if got := mux.Routes()[0].Pattern(); got != "GET /tenants/{tenant}/users/{id}" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "GET /tenants/{tenant}/users/{id}", got)
+	}
+}
+
+func Test_Prefix_Invalid(t *testing.T) {
+	mux := muxify.NewMux()
+	invalid := mux.Subrouter().Prefix("/a b")
+	nested := invalid.Subrouter().Prefix("/c")
+
+	if invalid.Err() == nil || nested.Err() == nil {
+		t.Fatalf("\nwant: errors\ngot: %v, %v\n", invalid.Err(), nested.Err())
+	}
+	if mux.Err() != nil {
+		t.Errorf("\nwant: no error\ngot: %v\n", mux.Err())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("\nwant: panic\ngot: none\n")
+		}
+	}()
+	nested.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {})
+}
+
+func Test_Remove(t *testing.T) {
+	mux := muxify.NewMux()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = w.Write([]byte("slow"))
+	})
+	mux.Subrouter().Prefix("/v1").HandleFunc("GET /a", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("a"))
+	})
+
+	inFlight := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mux.ServeHTTP(inFlight, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-started
+
+	mux.Remove(slow)
+	close(release)
+	<-done
+
+	if inFlight.Code != http.StatusOK || inFlight.Body.String() != "slow" {
+		t.Errorf("\nwant: %v\ngot: %v %v\n", "in flight request finished", inFlight.Code, inFlight.Body.String())
+	}
+
+	testCases := map[string]struct {
+		path          string
+		expStatusCode int
+	}{
+		"removed":   {path: "/slow", expStatusCode: http.StatusNotFound},
+		"remaining": {path: "/v1/a", expStatusCode: http.StatusOK},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+		})
+	}
+
+	if got := len(mux.Routes()); got != 1 {
+		t.Errorf("\nwant: %v\ngot: %v\n", 1, got)
+	}
+	// the pattern of a removed route can be registered again
+	mux.Update(func(mux *muxify.Mux) {
+		mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {})
+	})
+}
+
+func Test_Update(t *testing.T) {
+	handler := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(body))
+		}
+	}
+	get := func(mux *muxify.Mux, path string) string {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Body.String()
+	}
+
+	mux := muxify.NewMux()
+	old := mux.HandleFunc("GET /feature", handler("old"))
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// the route is never missing while it is replaced
+			if got := get(mux, "/feature"); got != "old" && got != "new" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "old or new", got)
+				return
+			}
+		}
+	}()
+
+	mux.Update(func(mux *muxify.Mux) {
+		mux.Remove(old)
+		mux.HandleFunc("GET /feature", handler("new"))
+	})
+	close(stop)
+	<-done
+
+	if got := get(mux, "/feature"); got != "new" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "new", got)
+	}
+
+	t.Run("conflict", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("\nwant: panic\ngot: none\n")
+			}
+			if got := len(mux.Routes()); got != 1 {
+				t.Errorf("\nwant: %v\ngot: %v\n", 1, got)
+			}
+			if got := get(mux, "/other"); got == "other" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "no change applied", got)
+			}
+		}()
+		mux.Update(func(mux *muxify.Mux) {
+			mux.HandleFunc("GET /other", handler("other"))
+			mux.HandleFunc("GET /feature", handler("conflict"))
+		})
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		defer func() {
+			if got := recover(); got != "abort" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "abort", got)
+			}
+			if got := get(mux, "/nested"); got == "nested" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "no change applied", got)
+			}
+		}()
+		mux.Update(func(mux *muxify.Mux) {
+			mux.Update(func(mux *muxify.Mux) {
+				mux.HandleFunc("GET /nested", handler("nested"))
+			})
+			panic("abort")
+		})
+	})
+
+	t.Run("nested applied", func(t *testing.T) {
+		mux.Update(func(mux *muxify.Mux) {
+			mux.Update(func(mux *muxify.Mux) {
+				mux.HandleFunc("GET /nested", handler("nested"))
+			})
+		})
+		if got := get(mux, "/nested"); got != "nested" {
+			t.Errorf("\nwant: %v\ngot: %v\n", "nested", got)
+		}
+	})
+}
+
+func Test_Seal(t *testing.T) {
+	noop := func(next http.Handler) http.Handler { return next }
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	testCases := map[string]func(mux *muxify.Mux){
+		"handle": func(mux *muxify.Mux) {
+			mux.HandleFunc("GET /b", handler)
+		},
+		"handle on sub mux": func(mux *muxify.Mux) {
+			mux.Subrouter().Prefix("/v1").HandleFunc("GET /b", handler)
+		},
+		"use": func(mux *muxify.Mux) {
+			mux.Use(noop)
+		},
+		"use named": func(mux *muxify.Mux) {
+			mux.UseNamed("noop", noop)
+		},
+		"pre": func(mux *muxify.Mux) {
+			mux.Pre(noop)
+		},
+		"redirect": func(mux *muxify.Mux) {
+			mux.Redirect("GET /old", "/a", http.StatusMovedPermanently)
+		},
+		"pre within update": func(mux *muxify.Mux) {
+			mux.Update(func(mux *muxify.Mux) { mux.Pre(noop) })
+		},
+	}
+	for tname, register := range testCases {
+		for _, seal := range []string{"seal", "serve"} {
+			t.Run(tname+" after "+seal, func(t *testing.T) {
+				mux := muxify.NewMux()
+				mux.HandleFunc("GET /a", handler)
+				if seal == "seal" {
+					mux.Seal()
+				} else {
+					mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a", nil))
+				}
+
+				defer func() {
+					if got := recover(); got != muxify.ErrSealed {
+						t.Errorf("\nwant: %v\ngot: %v\n", muxify.ErrSealed, got)
+					}
+				}()
+				register(mux)
+			})
+		}
+	}
+
+	t.Run("update", func(t *testing.T) {
+		mux := muxify.NewMux()
+		mux.Seal()
+		mux.Update(func(mux *muxify.Mux) {
+			sub := mux.Subrouter().Prefix("/plugin")
+			sub.Use(noop)
+			sub.HandleFunc("GET /b", handler)
+		})
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/plugin/b", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("\nwant: %v\ngot: %v\n", http.StatusOK, rec.Code)
+		}
+	})
+}
+
+func Test_Seal_ConcurrentUpdate(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	mux := muxify.NewMux()
+	mux.HandleFunc("GET /a", handler)
+	mux.Seal()
+
+	updating := make(chan struct{})
+	registered := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			if got := recover(); got != "update failed" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "update failed", got)
+			}
+		}()
+		mux.Update(func(mux *muxify.Mux) {
+			mux.HandleFunc("GET /b", handler)
+			close(updating)
+			<-registered
+			panic("update failed")
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		defer close(registered)
+		<-updating
+		defer func() {
+			if got := recover(); got != muxify.ErrSealed {
+				t.Errorf("\nwant: %v\ngot: %v\n", muxify.ErrSealed, got)
+			}
+		}()
+		// registration outside of the update is still sealed
+		mux.HandleFunc("GET /c", handler)
+	}()
+	wg.Wait()
+
+	routes := mux.Routes()
+	if len(routes) != 1 || routes[0].Pattern() != "GET /a" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "GET /a", routes)
+	}
+}
+
+func Test_ConcurrentRegistration(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(testMiddleware1)
+
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub := mux.Subrouter().Prefix(fmt.Sprintf("/s%d", i))
+			sub.Use(testMiddleware2)
+			sub.UseNamed("mw3", testMiddleware3)
+			for j := range 10 {
+				sub.HandleFunc(fmt.Sprintf("GET /r%d", j), func(w http.ResponseWriter, r *http.Request) {
+					_, _ = w.Write([]byte("ok"))
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(mux.Routes()); got != 100 {
+		t.Fatalf("\nwant: %v\ngot: %v\n", 100, got)
+	}
+
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/s%d/r%d", i, i), nil))
+			if got := rec.Body.String(); got != "MW1:MW2:MW3:ok" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "MW1:MW2:MW3:ok", got)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mux.Update(func(mux *muxify.Mux) {
+			mux.HandleFunc("GET /late", func(w http.ResponseWriter, r *http.Request) {})
+		})
+	}()
+	wg.Wait()
+}
+
+func Test_Route_ConcurrentSetters(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.UseNamed("mw1", testMiddleware1)
+	mux.Use(muxify.MaxBody(1 << 10))
+	route := mux.HandleFunc("POST /a", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 50 {
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/a", nil))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			route.Require(fmt.Sprint("scope:", i)).MaxBody(int64(i + 1)).Skip("mw2")
+			_ = route.String()
+		}
+	}()
+	wg.Wait()
+
+	if got := len(route.Requirements()); got != 50 {
+		t.Errorf("\nwant: %v\ngot: %v\n", 50, got)
+	}
+}
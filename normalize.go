@@ -0,0 +1,289 @@
+package muxify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Option configures a Mux created with NewMux.
+type Option func(*options)
+
+// options are the path normalization options of a mux.
+type options struct {
+	trailingSlash   TrailingSlash
+	caseInsensitive bool
+	encodedSlashes  EncodedSlashes
+	cleanPath       bool
+}
+
+// TrailingSlash is the strategy for paths that only match a route
+// with or without a trailing slash.
+type TrailingSlash int
+
+const (
+	// TrailingSlashStrict keeps the policy of the http.ServeMux:
+	// "/users" and "/users/" are different paths and "/users" is
+	// redirected to a subtree "/users/".
+	TrailingSlashStrict TrailingSlash = iota
+	// TrailingSlashRedirectAdd redirects "/users" to "/users/"
+	// if only the latter matches a route.
+	TrailingSlashRedirectAdd
+	// TrailingSlashRedirectRemove redirects "/users/" to "/users"
+	// if only the latter matches a route.
+	TrailingSlashRedirectRemove
+	// TrailingSlashSame serves "/users" and "/users/" by the same route
+	// without a redirect.
+	TrailingSlashSame
+)
+
+// EncodedSlashes is the policy for encoded slashes ("%2F") in paths.
+type EncodedSlashes int
+
+const (
+	// EncodedSlashesKeep keeps the policy of the http.ServeMux:
+	// an encoded slash is part of a path segment, e.g. "/files/a%2Fb"
+	// matches "/files/{name}" with the name "a/b".
+	EncodedSlashesKeep EncodedSlashes = iota
+	// EncodedSlashesDecode treats encoded slashes as segment separators,
+	// e.g. "/files/a%2Fb" matches "/files/{dir}/{name}".
+	EncodedSlashesDecode
+	// EncodedSlashesReject answers requests with encoded slashes
+	// with 400 Bad Request.
+	EncodedSlashesReject
+)
+
+// WithTrailingSlash sets the trailing slash strategy.
+// Paths that match a route as they are (other than a subtree
+// like "/") are never changed. Defaults to TrailingSlashStrict.
+func WithTrailingSlash(strategy TrailingSlash) Option {
+	return func(o *options) {
+		o.trailingSlash = strategy
+	}
+}
+
+// WithCaseInsensitive matches paths case-insensitively by trying the
+// lower-cased path if the path does not match a route as it is.
+// Patterns must be registered in lower case. Wildcard values keep
+// the case of the request path.
+func WithCaseInsensitive() Option {
+	return func(o *options) {
+		o.caseInsensitive = true
+	}
+}
+
+// WithEncodedSlashes sets the policy for encoded slashes.
+// Defaults to EncodedSlashesKeep.
+func WithEncodedSlashes(policy EncodedSlashes) Option {
+	return func(o *options) {
+		o.encodedSlashes = policy
+	}
+}
+
+// WithCleanPath serves unclean paths (duplicate slashes, "." and ".."
+// segments) by the route of the clean path instead of redirecting
+// like the http.ServeMux does.
+func WithCleanPath() Option {
+	return func(o *options) {
+		o.cleanPath = true
+	}
+}
+
+// enabled reports whether any normalization is enabled.
+func (o options) enabled() bool {
+	return o != options{}
+}
+
+// normalize returns an http.Handler that normalizes the request path
+// according to the options before dispatching to the http.ServeMux.
+func (mux *Mux) normalize() http.Handler {
+	opts := mux.tree.opts
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sm := mux.tree.serveMux.Load()
+		if r.Method == http.MethodConnect {
+			sm.ServeHTTP(w, r)
+			return
+		}
+
+		switch opts.encodedSlashes {
+		case EncodedSlashesDecode:
+			if r.URL.RawPath != "" {
+				r = rewritePath(r, func(p string) string { return p })
+				r.URL.RawPath = ""
+			}
+		case EncodedSlashesReject:
+			if strings.Contains(strings.ToUpper(r.URL.RawPath), "%2F") {
+				http.Error(w, "encoded slash in path", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if opts.cleanPath {
+			if clean := cleanPath(r.URL.Path); clean != r.URL.Path {
+				r = rewritePath(r, cleanPath)
+			}
+		}
+
+		if c := resolve(sm, opts, r); c != nil {
+			if c.toggled && opts.trailingSlash != TrailingSlashSame {
+				redirectPath(w, r, c.r.URL)
+				return
+			}
+			if c.lowered {
+				original := originalPath{lowered: c.r.URL.EscapedPath(), path: r.URL.EscapedPath()}
+				c.r = c.r.WithContext(context.WithValue(c.r.Context(), originalPathKey, original))
+			}
+			r = c.r
+		}
+
+		sm.ServeHTTP(w, r)
+	})
+}
+
+// pathCandidate is a variant of the request path the mux tries to match.
+type pathCandidate struct {
+	r       *http.Request
+	toggled bool
+	lowered bool
+}
+
+// resolve returns the variant of the request path to dispatch: the lower-cased
+// path and the path with the trailing slash toggled (as far as the options allow)
+// are tried after the path as it is. A variant that matches a route exactly wins
+// over one that matches a subtree. It returns nil if no variant matches.
+func resolve(sm *http.ServeMux, opts options, r *http.Request) *pathCandidate {
+	candidates := []pathCandidate{{r: r}}
+	if opts.caseInsensitive {
+		if lower := rewritePath(r, strings.ToLower); lower.URL.Path != r.URL.Path {
+			candidates = append(candidates, pathCandidate{r: lower, lowered: true})
+		}
+	}
+	if opts.trailingSlash != TrailingSlashStrict && r.URL.Path != "/" {
+		for _, c := range candidates {
+			toggled := rewritePath(c.r, toggleTrailingSlash)
+			added := strings.HasSuffix(toggled.URL.Path, "/")
+			if opts.trailingSlash == TrailingSlashSame ||
+				opts.trailingSlash == TrailingSlashRedirectAdd && added ||
+				opts.trailingSlash == TrailingSlashRedirectRemove && !added {
+				candidates = append(candidates, pathCandidate{r: toggled, toggled: true, lowered: c.lowered})
+			}
+		}
+	}
+
+	var subtree *pathCandidate
+	for i, c := range candidates {
+		route := match(sm, c.r)
+		switch {
+		case route == nil:
+		case !route.subtree():
+			return &candidates[i]
+		case subtree == nil:
+			subtree = &candidates[i]
+		}
+	}
+	return subtree
+}
+
+// match returns the registered route the http.ServeMux dispatches
+// the request to or nil if it answers with a redirect or an error.
+func match(sm *http.ServeMux, r *http.Request) *Route {
+	h, _ := sm.Handler(r)
+	if rh, ok := h.(*routeHandler); ok {
+		return rh.route
+	}
+	return nil
+}
+
+// originalPath is the request path before it was lower-cased
+// to match a route case-insensitively.
+type originalPath struct {
+	lowered string
+	path    string
+}
+
+// restorePathValues sets the wildcard values of the route from the
+// original path of a request matched case-insensitively.
+func restorePathValues(r *http.Request, route *Route) {
+	original, ok := r.Context().Value(originalPathKey).(originalPath)
+	// a rewritten request has another path
+	if !ok || original.lowered != r.URL.EscapedPath() {
+		return
+	}
+
+	_, p := splitPattern(route.pattern)
+	segments := strings.Split(strings.TrimPrefix(original.path, "/"), "/")
+	for i, seg := range strings.Split(strings.TrimPrefix(p, "/"), "/") {
+		if i >= len(segments) {
+			return
+		}
+		if !strings.HasPrefix(seg, "{") || seg == "{$}" {
+			continue
+		}
+		name, multi := strings.CutSuffix(seg[1:len(seg)-1], "...")
+		value := segments[i]
+		if multi {
+			value = strings.Join(segments[i:], "/")
+		}
+		if v, err := url.PathUnescape(value); err == nil {
+			r.SetPathValue(name, v)
+		}
+	}
+}
+
+// rewritePath returns a shallow copy of r with f applied to the path.
+func rewritePath(r *http.Request, f func(string) string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	u.Path = f(u.Path)
+	if u.RawPath != "" {
+		u.RawPath = f(u.RawPath)
+		// drop an encoding that does not fit the path anymore
+		if u.EscapedPath() != u.RawPath {
+			u.RawPath = ""
+		}
+	}
+	r2.URL = &u
+	return r2
+}
+
+// toggleTrailingSlash adds a trailing slash to p or removes it.
+func toggleTrailingSlash(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return strings.TrimSuffix(p, "/")
+	}
+	return p + "/"
+}
+
+// cleanPath returns the canonical path for p
+// keeping a trailing slash.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	clean := path.Clean(p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+// redirectPath redirects to the URL keeping the query.
+// Safe methods are redirected with 301 Moved Permanently,
+// others with 308 Permanent Redirect to keep the method and body.
+func redirectPath(w http.ResponseWriter, r *http.Request, u *url.URL) {
+	code := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	target := u.EscapedPath()
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, code)
+}
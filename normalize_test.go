@@ -0,0 +1,172 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_NewMux_Options(t *testing.T) {
+	newMux := func(opts ...muxify.Option) *muxify.Mux {
+		mux := muxify.NewMux(opts...)
+		mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("root"))
+		})
+		mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("users"))
+		})
+		mux.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("user " + r.PathValue("id")))
+		})
+		mux.HandleFunc("GET /files/{name}", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("file " + r.PathValue("name")))
+		})
+		mux.HandleFunc("GET /files/{dir}/{name}", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("dir " + r.PathValue("dir") + " file " + r.PathValue("name")))
+		})
+
+		v1 := mux.Subrouter().Prefix("/v1")
+		v1.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("v1"))
+		})
+		return mux
+	}
+
+	testCases := map[string]struct {
+		opts          []muxify.Option
+		method        string
+		path          string
+		expStatusCode int
+		expBody       string
+		expLocation   string
+	}{
+		"strict - trailing slash is another path": {
+			path:          "/users/",
+			expStatusCode: http.StatusOK,
+			expBody:       "root",
+		},
+		"same - trailing slash removed": {
+			opts:          []muxify.Option{muxify.WithTrailingSlash(muxify.TrailingSlashSame)},
+			path:          "/users/",
+			expStatusCode: http.StatusOK,
+			expBody:       "users",
+		},
+		"same - trailing slash added": {
+			opts:          []muxify.Option{muxify.WithTrailingSlash(muxify.TrailingSlashSame)},
+			path:          "/v1",
+			expStatusCode: http.StatusOK,
+			expBody:       "v1",
+		},
+		"same - exact match untouched": {
+			opts:          []muxify.Option{muxify.WithTrailingSlash(muxify.TrailingSlashSame)},
+			path:          "/users",
+			expStatusCode: http.StatusOK,
+			expBody:       "users",
+		},
+		"redirect remove": {
+			opts:          []muxify.Option{muxify.WithTrailingSlash(muxify.TrailingSlashRedirectRemove)},
+			path:          "/users/?page=2",
+			expStatusCode: http.StatusMovedPermanently,
+			expLocation:   "/users?page=2",
+		},
+		"redirect remove - no route for the method": {
+			opts:          []muxify.Option{muxify.WithTrailingSlash(muxify.TrailingSlashRedirectRemove)},
+			method:        http.MethodPost,
+			path:          "/users/",
+			expStatusCode: http.StatusMethodNotAllowed,
+		},
+		"redirect add": {
+			opts:          []muxify.Option{muxify.WithTrailingSlash(muxify.TrailingSlashRedirectAdd)},
+			path:          "/v1",
+			expStatusCode: http.StatusMovedPermanently,
+			expLocation:   "/v1/",
+		},
+		"redirect add - no redirect to remove": {
+			opts:          []muxify.Option{muxify.WithTrailingSlash(muxify.TrailingSlashRedirectAdd)},
+			path:          "/users/",
+			expStatusCode: http.StatusOK,
+			expBody:       "root",
+		},
+		"case insensitive - wildcard keeps its case": {
+			opts:          []muxify.Option{muxify.WithCaseInsensitive()},
+			path:          "/Users/ABC",
+			expStatusCode: http.StatusOK,
+			expBody:       "user ABC",
+		},
+		"case insensitive - escaped wildcards keep their case": {
+			opts:          []muxify.Option{muxify.WithCaseInsensitive()},
+			path:          "/FILES/My%20Docs/ReadMe.TXT",
+			expStatusCode: http.StatusOK,
+			expBody:       "dir My Docs file ReadMe.TXT",
+		},
+		"case insensitive - with trailing slash": {
+			opts: []muxify.Option{
+				muxify.WithCaseInsensitive(),
+				muxify.WithTrailingSlash(muxify.TrailingSlashSame),
+			},
+			path:          "/USERS/AbC/",
+			expStatusCode: http.StatusOK,
+			expBody:       "user AbC",
+		},
+		"case sensitive": {
+			path:          "/Users/ABC",
+			expStatusCode: http.StatusOK,
+			expBody:       "root",
+		},
+		"encoded slash kept": {
+			path:          "/files/a%2Fb",
+			expStatusCode: http.StatusOK,
+			expBody:       "file a/b",
+		},
+		"encoded slash decoded": {
+			opts:          []muxify.Option{muxify.WithEncodedSlashes(muxify.EncodedSlashesDecode)},
+			path:          "/files/a%2Fb",
+			expStatusCode: http.StatusOK,
+			expBody:       "dir a file b",
+		},
+		"encoded slash rejected": {
+			opts:          []muxify.Option{muxify.WithEncodedSlashes(muxify.EncodedSlashesReject)},
+			path:          "/files/a%2fb",
+			expStatusCode: http.StatusBadRequest,
+		},
+		"unclean path cleaned": {
+			opts:          []muxify.Option{muxify.WithCleanPath()},
+			path:          "/users//1",
+			expStatusCode: http.StatusOK,
+			expBody:       "user 1",
+		},
+		"combined": {
+			opts: []muxify.Option{
+				muxify.WithCleanPath(),
+				muxify.WithCaseInsensitive(),
+				muxify.WithTrailingSlash(muxify.TrailingSlashSame),
+			},
+			path:          "//USERS/",
+			expStatusCode: http.StatusOK,
+			expBody:       "users",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tc.path, nil)
+			rec := httptest.NewRecorder()
+			newMux(tc.opts...).ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if tc.expBody != "" && rec.Body.String() != tc.expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBody, rec.Body.String())
+			}
+			if got := rec.Header().Get("Location"); got != tc.expLocation {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expLocation, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package muxify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultProxyMaxFails is the default number of consecutive failures
+	// after which an upstream is taken out of the rotation.
+	DefaultProxyMaxFails = 3
+	// DefaultProxyFailTimeout is the default duration an upstream
+	// is taken out of the rotation for.
+	DefaultProxyFailTimeout = 30 * time.Second
+)
+
+// Balance is the strategy to pick the upstream of a proxied request.
+type Balance int
+
+const (
+	// BalanceRoundRobin picks the upstreams in turn.
+	BalanceRoundRobin Balance = iota
+	// BalanceLeastConnections picks the upstream with the fewest
+	// requests in flight.
+	BalanceLeastConnections
+)
+
+// ProxyOptions configures Mux.Proxy.
+type ProxyOptions struct {
+	// Upstreams are further targets the requests are balanced across.
+	Upstreams []*url.URL
+	// Balance is the strategy to pick an upstream. Defaults to BalanceRoundRobin.
+	Balance Balance
+	// KeepPrefix forwards the path with the prefix (of the mux and of Proxy).
+	// The prefix is stripped by default.
+	KeepPrefix bool
+	// RewritePrefix replaces the stripped prefix, e.g. "/internal/v2".
+	RewritePrefix string
+	// MaxFails is the number of consecutive failures (transport errors and
+	// 502, 503 and 504 responses) after which an upstream is taken out of
+	// the rotation for FailTimeout. Defaults to DefaultProxyMaxFails.
+	MaxFails int
+	// FailTimeout defaults to DefaultProxyFailTimeout.
+	FailTimeout time.Duration
+	// Transport defaults to http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Proxy registers a route that forwards all requests below the prefix,
+// which is appended to the prefix of the mux, to the target and the further
+// upstreams of the options. The middlewares of the mux apply.
+//
+// The path of the target is joined with the path of the request without
+// the prefix, e.g. "/api/users/1" is forwarded to "http://users:8080/v1/users/1"
+// by
+//
+//	api := mux.Subrouter().Prefix("/api")
+//	api.Proxy("/users", &url.URL{Scheme: "http", Host: "users:8080", Path: "/v1/users"}, muxify.ProxyOptions{})
+//
+// The X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto headers are
+// set, a stripped prefix is passed in X-Forwarded-Prefix.
+// Upstreams that fail are skipped until their fail timeout passes. If all
+// upstreams failed, they are all tried again. The route listing shows the
+// upstreams and which of them are down.
+// The prefix itself is forwarded as well, e.g. "/api/users" to
+// "http://users:8080/v1/users". Its route is removed with the returned one.
+// It panics if the prefix is invalid.
+func (mux *Mux) Proxy(prefix string, target *url.URL, opts ProxyOptions) *Route {
+	if opts.MaxFails <= 0 {
+		opts.MaxFails = DefaultProxyMaxFails
+	}
+	if opts.FailTimeout <= 0 {
+		opts.FailTimeout = DefaultProxyFailTimeout
+	}
+
+	sub := mux.Subrouter().Prefix(prefix)
+	p := &proxy{
+		opts:     opts,
+		segments: strings.Count(sub.patternPrefix, "/"),
+	}
+	for _, u := range append([]*url.URL{target}, opts.Upstreams...) {
+		p.upstreams = append(p.upstreams, p.newUpstream(u))
+	}
+
+	route := sub.Handle("/{proxy...}", p)
+	if sub.patternPrefix != "" {
+		// collection endpoints are not redirected to their subtree
+		exact := sub.Handle("", p).Annotate("proxy", p.String)
+		route.linked = []*Route{exact}
+	}
+	return route.Annotate("proxy", p.String)
+}
+
+// proxy balances requests across upstreams.
+type proxy struct {
+	opts      ProxyOptions
+	segments  int
+	upstreams []*upstream
+	next      atomic.Uint64
+}
+
+// upstream is a target of a proxy with its passive health state.
+type upstream struct {
+	target *url.URL
+	proxy  *httputil.ReverseProxy
+	active atomic.Int64
+
+	mu        sync.Mutex
+	fails     int
+	downUntil time.Time
+}
+
+func (p *proxy) newUpstream(target *url.URL) *upstream {
+	u := &upstream{target: target}
+	u.proxy = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			prefix, rest := splitSegments(pr.In.URL.EscapedPath(), p.segments)
+			// only the stripped prefix of this proxy is passed on
+			pr.Out.Header.Del("X-Forwarded-Prefix")
+			forwarded := pr.In.URL.EscapedPath()
+			if !p.opts.KeepPrefix {
+				forwarded = strings.TrimSuffix(p.opts.RewritePrefix, "/") + rest
+				pr.Out.URL.Path, _ = url.PathUnescape(forwarded)
+				pr.Out.URL.RawPath = forwarded
+				if prefix != "" {
+					pr.Out.Header.Set("X-Forwarded-Prefix", prefix)
+				}
+			}
+			pr.SetURL(target)
+			if forwarded == "" {
+				// the prefix itself is the path of the target, not its subtree
+				pr.Out.URL.Path, pr.Out.URL.RawPath = target.Path, target.RawPath
+			}
+			pr.SetXForwarded()
+		},
+		Transport: p.opts.Transport,
+		ModifyResponse: func(resp *http.Response) error {
+			switch resp.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				u.failed(p.opts.MaxFails, p.opts.FailTimeout)
+			default:
+				u.succeeded()
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			// a client that went away is not a failure of the upstream
+			if !errors.Is(err, context.Canceled) {
+				u.failed(p.opts.MaxFails, p.opts.FailTimeout)
+			}
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	return u
+}
+
+func (p *proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u := p.pick()
+	u.active.Add(1)
+	defer u.active.Add(-1)
+	u.proxy.ServeHTTP(w, r)
+}
+
+// pick returns the upstream for the next request.
+func (p *proxy) pick() *upstream {
+	now := time.Now()
+	candidates := make([]*upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if u.up(now) {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = p.upstreams
+	}
+
+	start := int(p.next.Add(1)-1) % len(candidates)
+	if p.opts.Balance != BalanceLeastConnections {
+		return candidates[start]
+	}
+	best := candidates[start]
+	for i := 1; i < len(candidates); i++ {
+		u := candidates[(start+i)%len(candidates)]
+		if u.active.Load() < best.active.Load() {
+			best = u
+		}
+	}
+	return best
+}
+
+// String returns the upstreams, those that are down are marked.
+func (p *proxy) String() string {
+	now := time.Now()
+	targets := make([]string, len(p.upstreams))
+	for i, u := range p.upstreams {
+		targets[i] = u.target.String()
+		if !u.up(now) {
+			targets[i] += "(down)"
+		}
+	}
+	return strings.Join(targets, ",")
+}
+
+// up reports whether the upstream is in the rotation.
+func (u *upstream) up(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !now.Before(u.downUntil)
+}
+
+// failed records a failure and takes the upstream out of the rotation
+// after maxFails consecutive failures.
+func (u *upstream) failed(maxFails int, timeout time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.fails++
+	if u.fails >= maxFails {
+		u.fails = 0
+		u.downUntil = time.Now().Add(timeout)
+	}
+}
+
+// succeeded resets the consecutive failures.
+func (u *upstream) succeeded() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.fails = 0
+}
+
+// splitSegments splits the first n segments off the escaped path p.
+// The rest keeps its leading slash, it is empty if p has n segments.
+func splitSegments(p string, n int) (prefix, rest string) {
+	i := 0
+	for ; n > 0 && i < len(p); n-- {
+		j := strings.IndexByte(p[i+1:], '/')
+		if j < 0 {
+			return p, ""
+		}
+		i += j + 1
+	}
+	return p[:i], p[i:]
+}
@@ -0,0 +1,196 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func newUpstream(t *testing.T, name string) (*httptest.Server, *url.URL) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(name + " " + r.URL.EscapedPath() + " " + r.Header.Get("X-Forwarded-Prefix") +
+			" " + r.Header.Get("X-Forwarded-Host") + " " + r.Header.Get("X-Forwarded-Proto")))
+	}))
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, u
+}
+
+func Test_Proxy(t *testing.T) {
+	_, users := newUpstream(t, "users")
+	users.Path = "/v1/users"
+
+	mux := muxify.NewMux()
+	api := mux.Subrouter().Prefix("/api")
+	api.Proxy("/users", users, muxify.ProxyOptions{})
+	api.Proxy("/tenants/{tenant}/keep", users, muxify.ProxyOptions{KeepPrefix: true})
+	api.Proxy("/old", users, muxify.ProxyOptions{RewritePrefix: "/legacy/"})
+
+	testCases := map[string]struct {
+		method        string
+		path          string
+		headers       map[string]string
+		expStatusCode int
+		expBody       string
+	}{
+		"strip prefix": {
+			method:        http.MethodGet,
+			path:          "/api/users/1?x=1",
+			expStatusCode: http.StatusOK,
+			expBody:       "users /v1/users/1 /api/users example.com http",
+		},
+		"exact prefix": {
+			method:        http.MethodPost,
+			path:          "/api/users",
+			expStatusCode: http.StatusOK,
+			expBody:       "users /v1/users /api/users example.com http",
+		},
+		"spoofed prefix replaced": {
+			method:        http.MethodGet,
+			path:          "/api/users/1",
+			headers:       map[string]string{"X-Forwarded-Prefix": "/evil"},
+			expStatusCode: http.StatusOK,
+			expBody:       "users /v1/users/1 /api/users example.com http",
+		},
+		"spoofed prefix removed": {
+			method:        http.MethodGet,
+			path:          "/api/tenants/acme/keep/1",
+			headers:       map[string]string{"X-Forwarded-Prefix": "/evil"},
+			expStatusCode: http.StatusOK,
+			expBody:       "users /v1/users/api/tenants/acme/keep/1  example.com http",
+		},
+		"escaped path": {
+			method:        http.MethodPost,
+			path:          "/api/users/a%2Fb",
+			expStatusCode: http.StatusOK,
+			expBody:       "users /v1/users/a%2Fb /api/users example.com http",
+		},
+		"keep prefix": {
+			method:        http.MethodGet,
+			path:          "/api/tenants/acme/keep/1",
+			expStatusCode: http.StatusOK,
+			expBody:       "users /v1/users/api/tenants/acme/keep/1  example.com http",
+		},
+		"rewrite prefix": {
+			method:        http.MethodDelete,
+			path:          "/api/old/1",
+			expStatusCode: http.StatusOK,
+			expBody:       "users /v1/users/legacy/1 /api/old example.com http",
+		},
+		"not proxied": {
+			method:        http.MethodGet,
+			path:          "/api/orders/1",
+			expStatusCode: http.StatusNotFound,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if tc.expBody != "" && rec.Body.String() != tc.expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_Proxy_Remove(t *testing.T) {
+	_, users := newUpstream(t, "users")
+
+	mux := muxify.NewMux()
+	route := mux.Proxy("/users", users, muxify.ProxyOptions{})
+	mux.Remove(route)
+
+	for _, path := range []string{"/users", "/users/1"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("\nwant: %v\ngot: %v\n", http.StatusNotFound, rec.Code)
+		}
+	}
+	if routes := mux.Routes(); len(routes) != 0 {
+		t.Errorf("\nwant: %v\ngot: %v\n", 0, len(routes))
+	}
+}
+
+func Test_Proxy_Balance(t *testing.T) {
+	_, a := newUpstream(t, "a")
+	_, b := newUpstream(t, "b")
+	dead, c := newUpstream(t, "c")
+	dead.Close()
+
+	mux := muxify.NewMux()
+	route := mux.Proxy("/", a, muxify.ProxyOptions{
+		Upstreams: []*url.URL{b, c},
+		MaxFails:  1,
+	})
+
+	var got []string
+	for range 6 {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		got = append(got, strings.Fields(rec.Body.String() + " -")[0])
+	}
+	// c fails once and is taken out of the rotation
+	if want := "a,b,-,b,a,b"; strings.Join(got, ",") != want {
+		t.Errorf("\nwant: %v\ngot: %v\n", want, strings.Join(got, ","))
+	}
+
+	want := "/{proxy...} proxy=" + a.String() + "," + b.String() + "," + c.String() + "(down)"
+	if route.String() != want {
+		t.Errorf("\nwant: %v\ngot: %v\n", want, route.String())
+	}
+}
+
+func Test_Proxy_LeastConnections(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-block
+		_, _ = w.Write([]byte("slow"))
+	}))
+	t.Cleanup(slow.Close)
+	_, fast := newUpstream(t, "fast")
+	slowURL, _ := url.Parse(slow.URL)
+
+	mux := muxify.NewMux()
+	mux.Proxy("/", slowURL, muxify.ProxyOptions{
+		Upstreams: []*url.URL{fast},
+		Balance:   muxify.BalanceLeastConnections,
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	<-started
+
+	// the slow upstream has a request in flight
+	for range 3 {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := strings.Fields(rec.Body.String())[0]; got != "fast" {
+			t.Errorf("\nwant: %v\ngot: %v\n", "fast", got)
+		}
+	}
+	close(block)
+	<-done
+}
@@ -0,0 +1,214 @@
+package muxify
+
+import (
+	"container/list"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRateLimitMaxKeys is the number of buckets the in-memory store
+// keeps when no other size is given.
+const DefaultRateLimitMaxKeys = 10000
+
+// KeyFunc extracts the key a request is rate limited by.
+// Requests that share a key share a bucket.
+type KeyFunc func(r *http.Request) string
+
+// KeyByRemoteIP keys requests by the IP address of the client.
+// It respects the client IP resolved by the RealIP middleware.
+func KeyByRemoteIP(r *http.Request) string {
+	return ClientIP(r)
+}
+
+// KeyByPattern keys requests by the registered pattern that matched them.
+func KeyByPattern(r *http.Request) string {
+	return RoutePattern(r)
+}
+
+// KeyByHeader keys requests by the value of the given header (e.g. a tenant or API key header).
+func KeyByHeader(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyByPathValue keys requests by the value of the given pattern wildcard.
+func KeyByPathValue(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.PathValue(name)
+	}
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	// Allowed reports whether a token was available.
+	Allowed bool
+	// Limit is the capacity of the bucket.
+	Limit int
+	// Remaining is the number of tokens left in the bucket.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token is available.
+	// It is only set if the request was not allowed.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore holds the token buckets of a rate limiter.
+// Implement it to share buckets between multiple instances of a service.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of the key.
+	// The bucket holds up to limit tokens and refills completely within period.
+	Take(key string, limit int, period time.Duration, now time.Time) (RateLimitResult, error)
+}
+
+// rateLimiters counts the RateLimit middlewares to name them.
+var rateLimiters atomic.Uint64
+
+// RateLimitOptions configures the RateLimit middleware.
+type RateLimitOptions struct {
+	// Limit is the number of requests allowed within Period.
+	// It is also the size of a burst.
+	Limit int
+	// Period is the time it takes for an empty bucket to refill.
+	Period time.Duration
+	// Key extracts the bucket key of a request.
+	// Defaults to KeyByRemoteIP.
+	Key KeyFunc
+	// Store holds the buckets.
+	// Defaults to a new in-memory store with DefaultRateLimitMaxKeys buckets.
+	Store RateLimitStore
+	// Name prefixes the bucket keys, so limiters sharing a store have
+	// their own buckets. Defaults to a name unique to the limiter within
+	// the process. Set it if a store is shared between instances of a service.
+	Name string
+	// LimitHandler is called for requests that exceed the limit.
+	// Defaults to a plain 429 Too Many Requests response.
+	LimitHandler http.Handler
+}
+
+// RateLimit returns a token bucket rate limiting middleware.
+// It sets the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers
+// and a Retry-After header for rejected requests.
+// Every call creates its own limiter, so each subrouter can Use its own limits.
+// If the store fails the request is let through.
+// It panics if Limit or Period is not positive.
+func RateLimit(opts RateLimitOptions) Middleware {
+	if opts.Limit <= 0 || opts.Period <= 0 {
+		panic("muxify: rate limit requires a positive limit and period")
+	}
+	if opts.Key == nil {
+		opts.Key = KeyByRemoteIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryRateLimitStore(DefaultRateLimitMaxKeys)
+	}
+	if opts.Name == "" {
+		opts.Name = "ratelimit" + strconv.FormatUint(rateLimiters.Add(1), 10)
+	}
+	if opts.LimitHandler == nil {
+		opts.LimitHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := opts.Store.Take(opts.Name+":"+opts.Key(r), opts.Limit, opts.Period, time.Now())
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", seconds(res.Reset))
+
+			if !res.Allowed {
+				h.Set("Retry-After", seconds(res.RetryAfter))
+				opts.LimitHandler.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds formats d as a number of whole seconds rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// memoryRateLimitStore is an in-memory RateLimitStore
+// that evicts the least recently used buckets.
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	maxKeys int
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+// bucket is a token bucket of the memoryRateLimitStore.
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryRateLimitStore returns an in-memory RateLimitStore that keeps
+// at most maxKeys buckets. Idle buckets are evicted first.
+func NewMemoryRateLimitStore(maxKeys int) RateLimitStore {
+	if maxKeys <= 0 {
+		maxKeys = DefaultRateLimitMaxKeys
+	}
+	return &memoryRateLimitStore{
+		maxKeys: maxKeys,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Take implements the RateLimitStore interface.
+func (s *memoryRateLimitStore) Take(key string, limit int, period time.Duration, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b *bucket
+	if e, ok := s.buckets[key]; ok {
+		s.lru.MoveToFront(e)
+		b = e.Value.(*bucket)
+	} else {
+		b = &bucket{key: key, tokens: float64(limit), last: now}
+		s.buckets[key] = s.lru.PushFront(b)
+		if s.lru.Len() > s.maxKeys {
+			oldest := s.lru.Back()
+			s.lru.Remove(oldest)
+			delete(s.buckets, oldest.Value.(*bucket).key)
+		}
+	}
+
+	// tokens refilled per nanosecond
+	rate := float64(limit) / float64(period)
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(limit), b.tokens+float64(elapsed)*rate)
+		b.last = now
+	}
+
+	res := RateLimitResult{Limit: limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((float64(limit) - b.tokens) / rate)
+
+	return res, nil
+}
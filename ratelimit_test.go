@@ -0,0 +1,172 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_RateLimit(t *testing.T) {
+	testCases := map[string]struct {
+		key            muxify.KeyFunc
+		tenants        []string
+		expStatusCodes []int
+		expRemaining   string
+		expRetryAfter  string
+	}{
+		"ok - below limit": {
+			tenants:        []string{"a", "a"},
+			expStatusCodes: []int{http.StatusOK, http.StatusOK},
+			expRemaining:   "0",
+		},
+		"limit exceeded": {
+			tenants:        []string{"a", "a", "a"},
+			expStatusCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+			expRemaining:   "0",
+			expRetryAfter:  "30",
+		},
+		"ok - keyed by header": {
+			key:            muxify.KeyByHeader("X-Tenant"),
+			tenants:        []string{"a", "a", "b"},
+			expStatusCodes: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+			expRemaining:   "1",
+		},
+		"ok - keyed by pattern": {
+			key:            muxify.KeyByPattern,
+			tenants:        []string{"a", "b", "c"},
+			expStatusCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+			expRemaining:   "0",
+			expRetryAfter:  "30",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			mux := muxify.NewMux()
+			mux.Use(muxify.RateLimit(muxify.RateLimitOptions{
+				Limit:  2,
+				Period: time.Minute,
+				Key:    tc.key,
+			}))
+			mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {})
+
+			var rec *httptest.ResponseRecorder
+			for i, tenant := range tc.tenants {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("X-Tenant", tenant)
+				rec = httptest.NewRecorder()
+				mux.ServeHTTP(rec, req)
+
+				if rec.Code != tc.expStatusCodes[i] {
+					t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCodes[i], rec.Code)
+				}
+			}
+
+			if got := rec.Header().Get("RateLimit-Limit"); got != "2" {
+				t.Errorf("\nwant: %v\ngot: %v\n", "2", got)
+			}
+			if got := rec.Header().Get("RateLimit-Remaining"); got != tc.expRemaining {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expRemaining, got)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tc.expRetryAfter {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expRetryAfter, got)
+			}
+		})
+	}
+}
+
+func Test_RateLimit_Subrouter(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.HandleFunc("GET /free", func(w http.ResponseWriter, r *http.Request) {})
+
+	limited := mux.Subrouter()
+	limited.Use(muxify.RateLimit(muxify.RateLimitOptions{Limit: 1, Period: time.Second}))
+	limited.HandleFunc("GET /limited", func(w http.ResponseWriter, r *http.Request) {})
+
+	testCases := []struct {
+		path          string
+		expStatusCode int
+	}{
+		{path: "/limited", expStatusCode: http.StatusOK},
+		{path: "/limited", expStatusCode: http.StatusTooManyRequests},
+		{path: "/free", expStatusCode: http.StatusOK},
+		{path: "/free", expStatusCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+		if rec.Code != tc.expStatusCode {
+			t.Errorf("%s\nwant: %v\ngot: %v\n", tc.path, tc.expStatusCode, rec.Code)
+		}
+	}
+}
+
+func Test_RateLimit_SharedStore(t *testing.T) {
+	store := muxify.NewMemoryRateLimitStore(100)
+	mux := muxify.NewMux()
+	mux.Use(muxify.RateLimit(muxify.RateLimitOptions{Limit: 3, Period: time.Minute, Store: store}))
+	mux.HandleFunc("GET /loose", func(w http.ResponseWriter, r *http.Request) {})
+
+	strict := mux.Subrouter()
+	strict.Use(muxify.RateLimit(muxify.RateLimitOptions{Limit: 1, Period: time.Minute, Store: store}))
+	strict.HandleFunc("GET /strict", func(w http.ResponseWriter, r *http.Request) {})
+
+	testCases := []struct {
+		path          string
+		expStatusCode int
+		expLimit      string
+	}{
+		{path: "/strict", expStatusCode: http.StatusOK, expLimit: "1"},
+		{path: "/strict", expStatusCode: http.StatusTooManyRequests, expLimit: "1"},
+		{path: "/loose", expStatusCode: http.StatusOK, expLimit: "3"},
+		{path: "/loose", expStatusCode: http.StatusTooManyRequests, expLimit: "3"},
+	}
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+		if rec.Code != tc.expStatusCode {
+			t.Errorf("%s\nwant: %v\ngot: %v\n", tc.path, tc.expStatusCode, rec.Code)
+		}
+		if got := rec.Header().Get("RateLimit-Limit"); got != tc.expLimit {
+			t.Errorf("%s\nwant: %v\ngot: %v\n", tc.path, tc.expLimit, got)
+		}
+	}
+}
+
+func Test_MemoryRateLimitStore(t *testing.T) {
+	store := muxify.NewMemoryRateLimitStore(1)
+	now := time.Now()
+
+	takes := []struct {
+		key          string
+		after        time.Duration
+		expAllowed   bool
+		expRemaining int
+	}{
+		{key: "a", expAllowed: true, expRemaining: 1},
+		{key: "a", expAllowed: true, expRemaining: 0},
+		{key: "a", expAllowed: false, expRemaining: 0},
+		{key: "a", after: 5 * time.Second, expAllowed: true, expRemaining: 0},
+		// evicts bucket a
+		{key: "b", expAllowed: true, expRemaining: 1},
+		{key: "a", expAllowed: true, expRemaining: 1},
+	}
+	for i, take := range takes {
+		now = now.Add(take.after)
+		res, err := store.Take(take.key, 2, 10*time.Second, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Allowed != take.expAllowed {
+			t.Errorf("take %d\nwant: %v\ngot: %v\n", i, take.expAllowed, res.Allowed)
+		}
+		if res.Remaining != take.expRemaining {
+			t.Errorf("take %d\nwant: %v\ngot: %v\n", i, take.expRemaining, res.Remaining)
+		}
+	}
+}
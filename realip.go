@@ -0,0 +1,159 @@
+package muxify
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RealIPOptions configures the RealIP middleware.
+type RealIPOptions struct {
+	// TrustedProxies are the IP addresses or CIDRs (e.g. "10.0.0.0/8")
+	// of the proxies whose forwarding headers are trusted.
+	TrustedProxies []string
+	// Header is the one forwarding header the trusted proxies maintain,
+	// e.g. "X-Forwarded-For", "Forwarded" or "X-Real-IP". The other
+	// forwarding headers are ignored, a client can't spoof the address
+	// with a header the proxies pass through unchanged.
+	// If empty, Forwarded is read before X-Forwarded-For before X-Real-IP.
+	Header string
+}
+
+// RealIP returns a middleware that resolves the IP address of the client
+// behind trusted proxies and makes it available via ClientIP.
+// The Forwarded (RFC 7239), X-Forwarded-For and X-Real-IP headers are only
+// read if the request comes from a trusted proxy. The chain of addresses
+// is walked from right to left and the first untrusted address is the client.
+// Without RealIPOptions.Header the first of the headers that is present wins,
+// so proxies that don't remove a Forwarded header sent by the client need
+// the header they set to be configured.
+// It panics if a trusted proxy is not a valid IP address or CIDR.
+func RealIP(opts RealIPOptions) Middleware {
+	trusted := make([]netip.Prefix, 0, len(opts.TrustedProxies))
+	for _, proxy := range opts.TrustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				panic("muxify: invalid trusted proxy " + proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+
+	isTrusted := func(addr netip.Addr) bool {
+		addr = addr.Unmap()
+		for _, prefix := range trusted {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, opts.Header, isTrusted)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, ip)))
+		})
+	}
+}
+
+// ClientIP returns the IP address of the client.
+// It is the address resolved by the RealIP middleware
+// or the host of r.RemoteAddr if RealIP is not used.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return remoteHost(r)
+}
+
+// resolveClientIP walks the forwarding chain of the header (or of the first
+// forwarding header present if empty) from right to left and returns the
+// first address that is not a trusted proxy.
+func resolveClientIP(r *http.Request, header string, isTrusted func(netip.Addr) bool) string {
+	remote, err := netip.ParseAddr(remoteHost(r))
+	if err != nil || !isTrusted(remote) {
+		return remoteHost(r)
+	}
+
+	var chain []string
+	if header != "" {
+		chain = forwardingChain(r.Header, header)
+	} else {
+		for _, name := range []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"} {
+			if chain = forwardingChain(r.Header, name); len(chain) > 0 {
+				break
+			}
+		}
+	}
+
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, err := parseNode(chain[i])
+		if err != nil {
+			// the trusted proxy does not know the client (e.g. "unknown")
+			break
+		}
+		client = addr
+		if !isTrusted(addr) {
+			break
+		}
+	}
+
+	return client.Unmap().String()
+}
+
+// forwardingChain returns the addresses of the forwarding header name.
+func forwardingChain(h http.Header, name string) []string {
+	if strings.EqualFold(name, "Forwarded") {
+		return forwardedFor(h.Values(name))
+	}
+	var chain []string
+	for _, v := range h.Values(name) {
+		chain = append(chain, strings.Split(v, ",")...)
+	}
+	return chain
+}
+
+// forwardedFor returns the "for" nodes of Forwarded header values.
+func forwardedFor(values []string) []string {
+	var nodes []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					nodes = append(nodes, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// parseNode parses an IP address that is optionally bracketed
+// and followed by a port, e.g. "[2001:db8::1]:4711" or "192.0.2.1:80".
+func parseNode(node string) (netip.Addr, error) {
+	node = strings.TrimSpace(node)
+	if addr, err := netip.ParseAddr(node); err == nil {
+		return addr, nil
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	return netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(node, "["), "]"))
+}
+
+// remoteHost returns the host of r.RemoteAddr.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
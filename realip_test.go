@@ -0,0 +1,144 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_RealIP(t *testing.T) {
+	testCases := map[string]struct {
+		remoteAddr string
+		header     string
+		headers    map[string][]string
+		expIP      string
+	}{
+		"ok - no proxy": {
+			remoteAddr: "198.51.100.7:1234",
+			expIP:      "198.51.100.7",
+		},
+		"untrusted remote ignores headers": {
+			remoteAddr: "198.51.100.7:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1"}},
+			expIP:      "198.51.100.7",
+		},
+		"ok - x-forwarded-for": {
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1"}},
+			expIP:      "203.0.113.1",
+		},
+		"ok - x-forwarded-for spoofed entries": {
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.1.1.1, 203.0.113.1, 10.0.0.2"}},
+			expIP:      "203.0.113.1",
+		},
+		"ok - multiple x-forwarded-for headers": {
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.1.1.1", "203.0.113.1,10.0.0.2"}},
+			expIP:      "203.0.113.1",
+		},
+		"ok - all trusted": {
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			expIP:      "10.0.0.3",
+		},
+		"ok - forwarded": {
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string][]string{
+				"Forwarded":       {`for=1.1.1.1, for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.2;by=10.0.0.1`},
+				"X-Forwarded-For": {"203.0.113.1"},
+			},
+			expIP: "2001:db8:cafe::17",
+		},
+		"ok - forwarded with port": {
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string][]string{"Forwarded": {`for="203.0.113.1:80"`}},
+			expIP:      "203.0.113.1",
+		},
+		"ok - forwarded unknown": {
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string][]string{"Forwarded": {"for=unknown, for=10.0.0.2"}},
+			expIP:      "10.0.0.2",
+		},
+		"ok - x-real-ip": {
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string][]string{"X-Real-Ip": {"203.0.113.1"}},
+			expIP:      "203.0.113.1",
+		},
+		"forwarded spoofed without header option": {
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string][]string{
+				"Forwarded":       {"for=198.51.100.99"},
+				"X-Forwarded-For": {"203.0.113.7"},
+			},
+			expIP: "198.51.100.99",
+		},
+		"ok - header option ignores spoofed forwarded": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Forwarded-For",
+			headers: map[string][]string{
+				"Forwarded":       {"for=198.51.100.99"},
+				"X-Forwarded-For": {"203.0.113.7"},
+			},
+			expIP: "203.0.113.7",
+		},
+		"ok - header option forwarded": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     "Forwarded",
+			headers: map[string][]string{
+				"Forwarded":       {"for=203.0.113.7"},
+				"X-Forwarded-For": {"198.51.100.99"},
+			},
+			expIP: "203.0.113.7",
+		},
+		"header option missing": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Real-IP",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.99"}},
+			expIP:      "10.0.0.1",
+		},
+		"ok - trusted single ip": {
+			remoteAddr: "[2001:db8::1]:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"203.0.113.1"}},
+			expIP:      "203.0.113.1",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			mux := muxify.NewMux()
+			mux.Use(muxify.RealIP(muxify.RealIPOptions{
+				TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"},
+				Header:         tc.header,
+			}))
+			mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(muxify.ClientIP(r)))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, values := range tc.headers {
+				for _, v := range values {
+					req.Header.Add(k, v)
+				}
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if got := rec.Body.String(); got != tc.expIP {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expIP, got)
+			}
+		})
+	}
+}
+
+func Test_ClientIP_WithoutRealIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+
+	if got := muxify.ClientIP(req); got != "198.51.100.7" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "198.51.100.7", got)
+	}
+}
@@ -0,0 +1,126 @@
+package muxify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// maxRewrites is the maximum number of rewrites of a request.
+const maxRewrites = 10
+
+// Redirect registers a route for the pattern that redirects to the target
+// with the given 3xx status code. Wildcards of the pattern and the prefix
+// are substituted in the target, e.g.
+//
+//	mux.Redirect("GET /old/{id}", "/new/{id}", http.StatusMovedPermanently)
+//
+// A target path is relative to the prefix of the mux like the pattern,
+// a target URL with a scheme is used as is. The query of the request
+// is kept unless the target has one.
+// It panics if the code is not a redirect code or the target uses
+// a wildcard that the pattern does not have.
+func (mux *Mux) Redirect(pattern, target string, code int) *Route {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		panic(fmt.Sprintf("muxify: invalid redirect code %d", code))
+	}
+	target = mux.target(pattern, target)
+
+	route := mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, expandTarget(target, r), code)
+	})
+	return route.Annotate("redirect", func() string { return target })
+}
+
+// Rewrite registers a route for the pattern that rewrites the path (and query)
+// of the request to the target and dispatches it again through the mux
+// without a round trip to the client. Wildcards are substituted like in Redirect.
+// The middlewares of both routes apply. A request is rewritten at most
+// 10 times, a rewrite loop is answered with 508 Loop Detected.
+// It panics if the target uses a wildcard that the pattern does not have.
+func (mux *Mux) Rewrite(pattern, target string) *Route {
+	target = mux.target(pattern, target)
+	if strings.Contains(target, "://") {
+		panic(fmt.Sprintf("muxify: rewrite target %q must be a path", target))
+	}
+
+	route := mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		rewrites, _ := r.Context().Value(rewriteKey).(int)
+		if rewrites >= maxRewrites {
+			http.Error(w, http.StatusText(http.StatusLoopDetected), http.StatusLoopDetected)
+			return
+		}
+
+		u, err := url.Parse(expandTarget(target, r))
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		r2 := r.WithContext(context.WithValue(r.Context(), rewriteKey, rewrites+1))
+		u2 := *r.URL
+		u2.Path, u2.RawPath, u2.RawQuery = u.Path, u.RawPath, u.RawQuery
+		r2.URL = &u2
+		mux.tree.dispatch.ServeHTTP(w, r2)
+	})
+	return route.Annotate("rewrite", func() string { return target })
+}
+
+// target returns the target with the prefix of the mux and checks
+// that its wildcards are wildcards of the pattern.
+func (mux *Mux) target(pattern, target string) string {
+	if strings.HasPrefix(target, "/") {
+		target = mux.prefix() + target
+	}
+
+	_, patternPath := splitPattern(pattern)
+	names := wildcardNames(mux.prefix() + patternPath)
+	targetPath, _, _ := strings.Cut(target, "?")
+	for _, name := range wildcardNames(targetPath) {
+		if !slices.Contains(names, name) {
+			panic(fmt.Sprintf("muxify: target %q uses unknown wildcard %q", target, name))
+		}
+	}
+	return target
+}
+
+// expandTarget substitutes the wildcards of the target
+// with the escaped path values of the request.
+func expandTarget(target string, r *http.Request) string {
+	targetPath, query, hasQuery := strings.Cut(target, "?")
+
+	segments := strings.Split(targetPath, "/")
+	for i, seg := range segments {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			continue
+		}
+		name := seg[1 : len(seg)-1]
+		switch {
+		case name == "$":
+			segments[i] = ""
+		case strings.HasSuffix(name, "..."):
+			rest := strings.Split(r.PathValue(strings.TrimSuffix(name, "...")), "/")
+			for j, s := range rest {
+				rest[j] = url.PathEscape(s)
+			}
+			segments[i] = strings.Join(rest, "/")
+		default:
+			segments[i] = url.PathEscape(r.PathValue(name))
+		}
+	}
+	target = strings.Join(segments, "/")
+
+	switch {
+	case hasQuery:
+		target += "?" + query
+	case r.URL.RawQuery != "":
+		target += "?" + r.URL.RawQuery
+	}
+	return target
+}
@@ -0,0 +1,135 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_Redirect(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Redirect("GET /old/{id}", "/new/{id}", http.StatusMovedPermanently)
+	mux.Redirect("/docs/{path...}", "https://docs.example.com/{path...}?ref=api", http.StatusFound)
+
+	api := mux.Subrouter().Prefix("/api")
+	api.Redirect("POST /v1/users/{id}", "/v2/users/{id}", http.StatusPermanentRedirect)
+
+	testCases := map[string]struct {
+		method        string
+		path          string
+		expStatusCode int
+		expLocation   string
+	}{
+		"wildcard": {
+			method:        http.MethodGet,
+			path:          "/old/42?page=2",
+			expStatusCode: http.StatusMovedPermanently,
+			expLocation:   "/new/42?page=2",
+		},
+		"escaped wildcard": {
+			method:        http.MethodGet,
+			path:          "/old/a%2Fb",
+			expStatusCode: http.StatusMovedPermanently,
+			expLocation:   "/new/a%2Fb",
+		},
+		"multi wildcard to url": {
+			method:        http.MethodGet,
+			path:          "/docs/guide/intro?ignored=1",
+			expStatusCode: http.StatusFound,
+			expLocation:   "https://docs.example.com/guide/intro?ref=api",
+		},
+		"prefixed target": {
+			method:        http.MethodPost,
+			path:          "/api/v1/users/7",
+			expStatusCode: http.StatusPermanentRedirect,
+			expLocation:   "/api/v2/users/7",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.path, nil))
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if got := rec.Header().Get("Location"); got != tc.expLocation {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expLocation, got)
+			}
+		})
+	}
+
+	if got := mux.Routes()[0].String(); got != "GET /old/{id} redirect=/new/{id}" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "GET /old/{id} redirect=/new/{id}", got)
+	}
+}
+
+func Test_Redirect_Invalid(t *testing.T) {
+	testCases := map[string]func(mux *muxify.Mux){
+		"code": func(mux *muxify.Mux) {
+			mux.Redirect("/a", "/b", http.StatusOK)
+		},
+		"unknown wildcard": func(mux *muxify.Mux) {
+			mux.Redirect("/a/{id}", "/b/{name}", http.StatusFound)
+		},
+		"rewrite to url": func(mux *muxify.Mux) {
+			mux.Rewrite("/a", "https://example.com/b")
+		},
+	}
+	for tname, register := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("\nwant: panic\ngot: none\n")
+				}
+			}()
+			register(muxify.NewMux())
+		})
+	}
+}
+
+func Test_Rewrite(t *testing.T) {
+	mark := func(name string) muxify.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Middleware", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	mux := muxify.NewMux()
+	users := mux.Subrouter().Prefix("/v2")
+	users.Use(mark("v2"))
+	users.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.PathValue("id") + " " + r.URL.RawQuery + " " + muxify.RoutePattern(r)))
+	})
+
+	legacy := mux.Subrouter()
+	legacy.Use(mark("legacy"))
+	legacy.Rewrite("GET /v1/users/{id}", "/v2/users/{id}")
+	legacy.Rewrite("GET /loop", "/loop")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/7?fields=name", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusOK, rec.Code)
+	}
+	if got, want := rec.Body.String(), "7 fields=name GET /v2/users/{id}"; got != want {
+		t.Errorf("\nwant: %v\ngot: %v\n", want, got)
+	}
+	if got, want := strings.Join(rec.Header().Values("X-Middleware"), ","), "legacy,v2"; got != want {
+		t.Errorf("\nwant: %v\ngot: %v\n", want, got)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/loop", nil))
+
+	if rec.Code != http.StatusLoopDetected {
+		t.Errorf("\nwant: %v\ngot: %v\n", http.StatusLoopDetected, rec.Code)
+	}
+}
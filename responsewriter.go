@@ -0,0 +1,158 @@
+package muxify
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter wraps an http.ResponseWriter and records
+// the status code and the number of bytes written.
+// Middlewares that need to inspect the response should use it
+// instead of writing their own wrapper.
+//
+// It implements http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom
+// by delegating to the wrapped http.ResponseWriter and implements Unwrap
+// for http.ResponseController.
+//
+// The methods are always there, even if the wrapped http.ResponseWriter
+// does not support them (e.g. HTTP/2 connections can't be hijacked), so a
+// type assertion like w.(http.Hijacker) always succeeds and Flush does
+// nothing if flushing is not supported. Handlers behind a ResponseWriter
+// must use http.ResponseController and check its errors, which are
+// http.ErrNotSupported if the wrapped http.ResponseWriter lacks the feature.
+type ResponseWriter struct {
+	w           http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+	hooks       []func(code int)
+}
+
+// WrapResponseWriter returns a ResponseWriter wrapping w.
+// If w already is a *ResponseWriter it is returned as is,
+// so multiple middlewares share the same wrapper.
+func WrapResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+	return &ResponseWriter{w: w}
+}
+
+// OnWriteHeader registers a hook that is called right before the header is written.
+// Hooks may still modify the header.
+func (rw *ResponseWriter) OnWriteHeader(hook func(code int)) {
+	rw.hooks = append(rw.hooks, hook)
+}
+
+// Status returns the status code written or 0 if the header is not written yet.
+func (rw *ResponseWriter) Status() int {
+	return rw.status
+}
+
+// BytesWritten returns the number of body bytes written.
+func (rw *ResponseWriter) BytesWritten() int64 {
+	return rw.bytes
+}
+
+// WroteHeader reports whether the header is written.
+func (rw *ResponseWriter) WroteHeader() bool {
+	return rw.wroteHeader
+}
+
+// Header implements the http.ResponseWriter interface.
+func (rw *ResponseWriter) Header() http.Header {
+	return rw.w.Header()
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+// Informational 1xx status codes are passed through without being recorded.
+func (rw *ResponseWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		rw.w.WriteHeader(code)
+		return
+	}
+	if rw.wroteHeader {
+		return
+	}
+
+	for _, hook := range rw.hooks {
+		hook(code)
+	}
+	rw.status = code
+	rw.wroteHeader = true
+	rw.w.WriteHeader(code)
+}
+
+// Write implements the http.ResponseWriter interface.
+func (rw *ResponseWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.w.Write(p)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom implements the io.ReaderFrom interface.
+func (rw *ResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	var n int64
+	var err error
+	if rf, ok := rw.w.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{rw.w}, r)
+	}
+	rw.bytes += n
+	return n, err
+}
+
+// Flush implements the http.Flusher interface.
+// It does nothing if the wrapped http.ResponseWriter does not support
+// flushing, use http.ResponseController to get the error.
+func (rw *ResponseWriter) Flush() {
+	_ = rw.FlushError()
+}
+
+// FlushError flushes the response and reports an error
+// if the wrapped http.ResponseWriter does not support flushing.
+// It is used by http.ResponseController.
+func (rw *ResponseWriter) FlushError() error {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return http.NewResponseController(rw.w).Flush()
+}
+
+// Hijack implements the http.Hijacker interface.
+// It returns http.ErrNotSupported if the wrapped http.ResponseWriter
+// does not support hijacking.
+func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.w).Hijack()
+}
+
+// Push implements the http.Pusher interface.
+// It returns http.ErrNotSupported if the wrapped http.ResponseWriter
+// does not support server push.
+func (rw *ResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := rw.w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the wrapped http.ResponseWriter for http.ResponseController.
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.w
+}
+
+// writerOnly hides any optional interfaces of the writer,
+// so io.Copy does not call back into ReadFrom.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,172 @@
+package muxify_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_ResponseWriter(t *testing.T) {
+	testCases := map[string]struct {
+		handler   http.HandlerFunc
+		expStatus int
+		expBytes  int64
+		expBody   string
+	}{
+		"ok - implicit status": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("muxify"))
+			},
+			expStatus: http.StatusOK,
+			expBytes:  6,
+			expBody:   "muxify",
+		},
+		"ok - explicit status": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte("tea"))
+			},
+			expStatus: http.StatusTeapot,
+			expBytes:  3,
+			expBody:   "tea",
+		},
+		"ok - informational status": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusCreated)
+			},
+			expStatus: http.StatusCreated,
+		},
+		"ok - read from": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(w, strings.NewReader("copied"))
+			},
+			expStatus: http.StatusOK,
+			expBytes:  6,
+			expBody:   "copied",
+		},
+		"ok - flush": {
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if err := http.NewResponseController(w).Flush(); err != nil {
+					t.Error(err)
+				}
+			},
+			expStatus: http.StatusOK,
+		},
+		"no write": {
+			handler:   func(w http.ResponseWriter, r *http.Request) {},
+			expStatus: 0,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rw := muxify.WrapResponseWriter(rec)
+
+			var hookStatus int
+			rw.OnWriteHeader(func(code int) {
+				hookStatus = code
+				rw.Header().Set("X-Hook", "called")
+			})
+
+			tc.handler(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got := rw.Status(); got != tc.expStatus {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatus, got)
+			}
+			if hookStatus != tc.expStatus {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatus, hookStatus)
+			}
+			if got := rw.BytesWritten(); got != tc.expBytes {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBytes, got)
+			}
+			if got := rec.Body.String(); got != tc.expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBody, got)
+			}
+			if rw.WroteHeader() && rec.Header().Get("X-Hook") != "called" {
+				t.Errorf("header modified by hook is missing")
+			}
+		})
+	}
+}
+
+func Test_WrapResponseWriter_Shared(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rw := muxify.WrapResponseWriter(rec)
+
+	if muxify.WrapResponseWriter(rw) != rw {
+		t.Errorf("wrapping a ResponseWriter twice returned a new wrapper")
+	}
+	if rw.Unwrap() != rec {
+		t.Errorf("Unwrap did not return the wrapped http.ResponseWriter")
+	}
+}
+
+func Test_ResponseWriter_Hijack(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(muxify.WrapResponseWriter(w), r)
+		})
+	})
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(body); got != "hijacked" {
+		t.Errorf("\nwant: %v\ngot: %v\n", "hijacked", got)
+	}
+}
+
+// plainWriter hides the optional interfaces of the wrapped http.ResponseWriter.
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func Test_ResponseWriter_NotSupported(t *testing.T) {
+	rw := muxify.WrapResponseWriter(plainWriter{httptest.NewRecorder()})
+	rc := http.NewResponseController(rw)
+
+	testCases := map[string]func() error{
+		"flush": rc.Flush,
+		"hijack": func() error {
+			_, _, err := rc.Hijack()
+			return err
+		},
+		"push": func() error {
+			return rw.Push("/style.css", nil)
+		},
+	}
+	for tname, call := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			if err := call(); !errors.Is(err, http.ErrNotSupported) {
+				t.Errorf("\nwant: %v\ngot: %v\n", http.ErrNotSupported, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package muxify
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Route is a pattern registered on a mux.
+// It carries metadata that middlewares can read from the request
+// with CurrentRoute.
+// Its methods are safe for concurrent use.
+type Route struct {
+	pattern string
+	handler http.Handler
+	// linked are routes registered together with the route,
+	// they are removed with it.
+	linked []*Route
+
+	mu           sync.Mutex
+	requirements []string
+	maxBody      int64
+	skip         []string
+	annotations  []annotation
+}
+
+// annotation is a key with a dynamic value shown in the route listing.
+type annotation struct {
+	key   string
+	value func() string
+}
+
+// Pattern returns the registered pattern (prefixes included).
+func (route *Route) Pattern() string {
+	return route.pattern
+}
+
+// subtree reports whether the route matches all paths below its pattern,
+// e.g. "/files/" or "/files/{path...}".
+func (route *Route) subtree() bool {
+	_, p := splitPattern(route.pattern)
+	return strings.HasSuffix(p, "/") || strings.HasSuffix(p, "...}")
+}
+
+// Require declares requirements of the route, e.g. "scope:users.write" or "role:admin".
+// All requirements must be met. They are enforced by the Authorize middleware.
+func (route *Route) Require(requirements ...string) *Route {
+	route.mu.Lock()
+	defer route.mu.Unlock()
+	route.requirements = append(route.requirements, requirements...)
+	return route
+}
+
+// Requirements returns the requirements of the route.
+func (route *Route) Requirements() []string {
+	return slices.Clone(route.required())
+}
+
+// required returns the requirements of the route without copying them.
+// Requirements are only appended, so the returned slice does not change.
+func (route *Route) required() []string {
+	route.mu.Lock()
+	defer route.mu.Unlock()
+	return slices.Clip(route.requirements)
+}
+
+// MaxBody limits the request body of the route to n bytes.
+// It overrides the limit of the MaxBody middleware, which must be used.
+func (route *Route) MaxBody(n int64) *Route {
+	route.mu.Lock()
+	defer route.mu.Unlock()
+	route.maxBody = n
+	return route
+}
+
+// bodyLimit returns the body limit of the route or 0 if it has none.
+func (route *Route) bodyLimit() int64 {
+	if route == nil {
+		return 0
+	}
+	route.mu.Lock()
+	defer route.mu.Unlock()
+	return route.maxBody
+}
+
+// Skip opts the route out of the named middlewares of its mux.
+func (route *Route) Skip(names ...string) *Route {
+	route.mu.Lock()
+	defer route.mu.Unlock()
+	route.skip = append(route.skip, names...)
+	return route
+}
+
+// skips reports whether the route opted out of the named middleware.
+func (route *Route) skips(name string) bool {
+	route.mu.Lock()
+	defer route.mu.Unlock()
+	return slices.Contains(route.skip, name)
+}
+
+// Annotate adds a key with a dynamic value to the route listing,
+// e.g. the state of a middleware. An existing key is replaced.
+// It is safe to call while the mux serves requests.
+func (route *Route) Annotate(key string, value func() string) *Route {
+	route.mu.Lock()
+	defer route.mu.Unlock()
+
+	for i, a := range route.annotations {
+		if a.key == key {
+			route.annotations[i].value = value
+			return route
+		}
+	}
+	route.annotations = append(route.annotations, annotation{key: key, value: value})
+	return route
+}
+
+// String returns the pattern followed by the requirements
+// and the annotations of the route.
+func (route *Route) String() string {
+	s := route.pattern
+	if requirements := route.required(); len(requirements) > 0 {
+		s += " [" + strings.Join(requirements, " ") + "]"
+	}
+
+	route.mu.Lock()
+	annotations := slices.Clone(route.annotations)
+	route.mu.Unlock()
+
+	for _, a := range annotations {
+		s += " " + a.key + "=" + a.value()
+	}
+	return s
+}
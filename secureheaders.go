@@ -0,0 +1,202 @@
+package muxify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// Content-Security-Policy source expressions.
+const (
+	CSPSelf             = "'self'"
+	CSPNone             = "'none'"
+	CSPUnsafeInline     = "'unsafe-inline'"
+	CSPUnsafeEval       = "'unsafe-eval'"
+	CSPStrictDynamic    = "'strict-dynamic'"
+	CSPReportSample     = "'report-sample'"
+	CSPNonceSource      = "'nonce-" + cspNoncePlaceholder + "'"
+	cspNoncePlaceholder = "{nonce}"
+)
+
+// CSP builds a Content-Security-Policy.
+// Use CSPNonceSource as a source to get a fresh nonce per request.
+type CSP struct {
+	directives []cspDirective
+}
+
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+// NewCSP returns an empty Content-Security-Policy builder.
+func NewCSP() *CSP {
+	return &CSP{}
+}
+
+// Directive adds the sources to a directive.
+func (csp *CSP) Directive(name string, sources ...string) *CSP {
+	for i, d := range csp.directives {
+		if d.name == name {
+			csp.directives[i].sources = append(d.sources, sources...)
+			return csp
+		}
+	}
+	csp.directives = append(csp.directives, cspDirective{name: name, sources: sources})
+	return csp
+}
+
+// DefaultSrc adds sources to the default-src directive.
+func (csp *CSP) DefaultSrc(sources ...string) *CSP { return csp.Directive("default-src", sources...) }
+
+// ScriptSrc adds sources to the script-src directive.
+func (csp *CSP) ScriptSrc(sources ...string) *CSP { return csp.Directive("script-src", sources...) }
+
+// StyleSrc adds sources to the style-src directive.
+func (csp *CSP) StyleSrc(sources ...string) *CSP { return csp.Directive("style-src", sources...) }
+
+// ImgSrc adds sources to the img-src directive.
+func (csp *CSP) ImgSrc(sources ...string) *CSP { return csp.Directive("img-src", sources...) }
+
+// ConnectSrc adds sources to the connect-src directive.
+func (csp *CSP) ConnectSrc(sources ...string) *CSP { return csp.Directive("connect-src", sources...) }
+
+// FontSrc adds sources to the font-src directive.
+func (csp *CSP) FontSrc(sources ...string) *CSP { return csp.Directive("font-src", sources...) }
+
+// ObjectSrc adds sources to the object-src directive.
+func (csp *CSP) ObjectSrc(sources ...string) *CSP { return csp.Directive("object-src", sources...) }
+
+// FrameAncestors adds sources to the frame-ancestors directive.
+func (csp *CSP) FrameAncestors(sources ...string) *CSP {
+	return csp.Directive("frame-ancestors", sources...)
+}
+
+// BaseURI adds sources to the base-uri directive.
+func (csp *CSP) BaseURI(sources ...string) *CSP { return csp.Directive("base-uri", sources...) }
+
+// FormAction adds sources to the form-action directive.
+func (csp *CSP) FormAction(sources ...string) *CSP { return csp.Directive("form-action", sources...) }
+
+// ReportTo sets the report-to directive.
+func (csp *CSP) ReportTo(group string) *CSP { return csp.Directive("report-to", group) }
+
+// UpgradeInsecureRequests adds the upgrade-insecure-requests directive.
+func (csp *CSP) UpgradeInsecureRequests() *CSP { return csp.Directive("upgrade-insecure-requests") }
+
+// String returns the policy. Nonce sources are left as placeholders.
+func (csp *CSP) String() string {
+	directives := make([]string, 0, len(csp.directives))
+	for _, d := range csp.directives {
+		directives = append(directives, strings.Join(append([]string{d.name}, d.sources...), " "))
+	}
+	return strings.Join(directives, "; ")
+}
+
+// SecureHeadersOptions configures the SecureHeaders middleware.
+// Empty fields leave the header untouched, so a subrouter can Use
+// another SecureHeaders middleware that overrides single headers only.
+type SecureHeadersOptions struct {
+	// StrictTransportSecurity is the Strict-Transport-Security header.
+	StrictTransportSecurity string
+	// ContentTypeOptions is the X-Content-Type-Options header.
+	ContentTypeOptions string
+	// FrameOptions is the X-Frame-Options header.
+	FrameOptions string
+	// ReferrerPolicy is the Referrer-Policy header.
+	ReferrerPolicy string
+	// PermissionsPolicy is the Permissions-Policy header.
+	PermissionsPolicy string
+	// CrossOriginOpenerPolicy is the Cross-Origin-Opener-Policy header.
+	CrossOriginOpenerPolicy string
+	// CrossOriginEmbedderPolicy is the Cross-Origin-Embedder-Policy header.
+	CrossOriginEmbedderPolicy string
+	// ContentSecurityPolicy is the Content-Security-Policy header.
+	// The policy is read when the middleware is created.
+	ContentSecurityPolicy *CSP
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only.
+	CSPReportOnly bool
+}
+
+// DefaultSecureHeadersOptions returns a strict set of security headers.
+func DefaultSecureHeadersOptions() SecureHeadersOptions {
+	return SecureHeadersOptions{
+		StrictTransportSecurity:   "max-age=63072000; includeSubDomains",
+		ContentTypeOptions:        "nosniff",
+		FrameOptions:              "DENY",
+		ReferrerPolicy:            "strict-origin-when-cross-origin",
+		PermissionsPolicy:         "camera=(), microphone=(), geolocation=()",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginEmbedderPolicy: "require-corp",
+		ContentSecurityPolicy: NewCSP().
+			DefaultSrc(CSPSelf).
+			ScriptSrc(CSPSelf, CSPNonceSource).
+			ObjectSrc(CSPNone).
+			BaseURI(CSPSelf).
+			FrameAncestors(CSPNone),
+	}
+}
+
+// SecureHeaders returns a middleware that sets security headers.
+// If the Content-Security-Policy contains CSPNonceSource, a fresh nonce
+// is generated per request and available via CSPNonce.
+func SecureHeaders(opts SecureHeadersOptions) Middleware {
+	headers := [][2]string{
+		{"Strict-Transport-Security", opts.StrictTransportSecurity},
+		{"X-Content-Type-Options", opts.ContentTypeOptions},
+		{"X-Frame-Options", opts.FrameOptions},
+		{"Referrer-Policy", opts.ReferrerPolicy},
+		{"Permissions-Policy", opts.PermissionsPolicy},
+		{"Cross-Origin-Opener-Policy", opts.CrossOriginOpenerPolicy},
+		{"Cross-Origin-Embedder-Policy", opts.CrossOriginEmbedderPolicy},
+	}
+
+	var csp string
+	if opts.ContentSecurityPolicy != nil {
+		csp = opts.ContentSecurityPolicy.String()
+	}
+	cspHeader := "Content-Security-Policy"
+	if opts.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	useNonce := strings.Contains(csp, cspNoncePlaceholder)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			for _, header := range headers {
+				if header[1] != "" {
+					h.Set(header[0], header[1])
+				}
+			}
+
+			if csp != "" {
+				// an overriding policy without nonce drops the nonce of a parent policy
+				var nonce string
+				if useNonce {
+					nonce = newCSPNonce()
+				}
+				h.Set(cspHeader, strings.ReplaceAll(csp, cspNoncePlaceholder, nonce))
+				r = r.WithContext(context.WithValue(r.Context(), cspNonceKey, nonce))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CSPNonce returns the Content-Security-Policy nonce of the request
+// for use in script and style tags or an empty string if there is none.
+func CSPNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(cspNonceKey).(string)
+	return nonce
+}
+
+// newCSPNonce returns a new random nonce.
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
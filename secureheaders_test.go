@@ -0,0 +1,102 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_SecureHeaders(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.SecureHeaders(muxify.DefaultSecureHeadersOptions()))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(muxify.CSPNonce(r)))
+	})
+
+	docs := mux.Subrouter().Prefix("/docs")
+	docs.Use(muxify.SecureHeaders(muxify.SecureHeadersOptions{
+		FrameOptions: "SAMEORIGIN",
+		ContentSecurityPolicy: muxify.NewCSP().
+			DefaultSrc(muxify.CSPSelf).
+			StyleSrc(muxify.CSPSelf, muxify.CSPUnsafeInline).
+			ImgSrc(muxify.CSPSelf, "data:"),
+	}))
+	docs.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(muxify.CSPNonce(r)))
+	})
+
+	testCases := map[string]struct {
+		path       string
+		expHeaders map[string]string
+	}{
+		"ok - defaults": {
+			path: "/",
+			expHeaders: map[string]string{
+				"Strict-Transport-Security":    "max-age=63072000; includeSubDomains",
+				"X-Content-Type-Options":       "nosniff",
+				"X-Frame-Options":              "DENY",
+				"Referrer-Policy":              "strict-origin-when-cross-origin",
+				"Cross-Origin-Opener-Policy":   "same-origin",
+				"Cross-Origin-Embedder-Policy": "require-corp",
+				"Content-Security-Policy":      "default-src 'self'; script-src 'self' 'nonce-{body}'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+			},
+		},
+		"ok - subrouter override": {
+			path: "/docs/",
+			expHeaders: map[string]string{
+				"Strict-Transport-Security": "max-age=63072000; includeSubDomains",
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Content-Security-Policy":   "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src 'self' data:",
+			},
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			nonce := rec.Body.String()
+			for k, v := range tc.expHeaders {
+				want := strings.ReplaceAll(v, "{body}", nonce)
+				if got := rec.Header().Get(k); got != want {
+					t.Errorf("%s\nwant: %v\ngot: %v\n", k, want, got)
+				}
+			}
+		})
+	}
+}
+
+func Test_SecureHeaders_NoncePerRequest(t *testing.T) {
+	mux := muxify.NewMux()
+	mux.Use(muxify.SecureHeaders(muxify.SecureHeadersOptions{
+		ContentSecurityPolicy: muxify.NewCSP().ScriptSrc(muxify.CSPNonceSource),
+		CSPReportOnly:         true,
+	}))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(muxify.CSPNonce(r)))
+	})
+
+	nonces := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		nonce := rec.Body.String()
+		if nonce == "" || nonces[nonce] {
+			t.Errorf("nonce %q is empty or reused", nonce)
+		}
+		nonces[nonce] = true
+
+		want := "script-src 'nonce-" + nonce + "'"
+		if got := rec.Header().Get("Content-Security-Policy-Report-Only"); got != want {
+			t.Errorf("\nwant: %v\ngot: %v\n", want, got)
+		}
+		if got := rec.Header().Get("X-Frame-Options"); got != "" {
+			t.Errorf("\nwant: %v\ngot: %v\n", "", got)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package muxify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ImmutableCacheControl is the Cache-Control header of hashed assets.
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+// StaticOptions configures Mux.Static.
+type StaticOptions struct {
+	// Index is the file served for a directory. Defaults to "index.html".
+	Index string
+	// Listing lists directories without an index file.
+	// Directories are not listed by default.
+	Listing bool
+	// SPAFallback serves the index file of the root for unknown paths
+	// without a file extension, so a single-page app can route them.
+	// Unknown paths with an extension (e.g. a missing asset) are still not found.
+	SPAFallback bool
+	// CacheControl is the Cache-Control header of files that are not immutable.
+	// Defaults to "no-cache", so clients revalidate them with the ETag.
+	CacheControl string
+	// Immutable reports whether a file never changes, e.g. because its name
+	// contains a content hash. Immutable files are cached for a year.
+	// Defaults to IsHashedAsset.
+	Immutable func(name string) bool
+}
+
+// hashedAsset matches file names with a content hash like
+// "app.3f2a1b9c.js" or "index-BRl6Zx3e.css".
+var hashedAsset = regexp.MustCompile(`[.-]([A-Za-z0-9_]{8,})\.[A-Za-z0-9]+$`)
+
+// IsHashedAsset reports whether the file name contains a content hash
+// of at least 8 characters with a digit, like "app.3f2a1b9c.js" or "index-BRl6Zx3e.css".
+func IsHashedAsset(name string) bool {
+	m := hashedAsset.FindStringSubmatch(path.Base(name))
+	return m != nil && strings.ContainsAny(m[1], "0123456789")
+}
+
+// Static registers a route that serves the files of fsys (e.g. an embed.FS
+// or os.DirFS) below the prefix, which is appended to the prefix of the mux.
+// The middlewares of the mux apply.
+//
+// Files get an ETag (a hash of the content) and a Last-Modified header,
+// conditional and range requests are answered accordingly. Precompressed
+// sidecar files ("app.js.br", "app.js.gz") are served instead of the file
+// if the client accepts their encoding.
+// It panics if the prefix is invalid.
+func (mux *Mux) Static(prefix string, fsys fs.FS, opts StaticOptions) *Route {
+	if opts.Index == "" {
+		opts.Index = "index.html"
+	}
+	if opts.CacheControl == "" {
+		opts.CacheControl = "no-cache"
+	}
+	if opts.Immutable == nil {
+		opts.Immutable = IsHashedAsset
+	}
+
+	s := &staticFiles{fsys: fsys, opts: opts, etags: make(map[staticKey]string)}
+	return mux.Subrouter().Prefix(prefix).Handle("GET /{file...}", s)
+}
+
+// staticFiles serves the files of a file system.
+type staticFiles struct {
+	fsys fs.FS
+	opts StaticOptions
+
+	mu    sync.Mutex
+	etags map[staticKey]string
+}
+
+// staticKey identifies a version of a file.
+type staticKey struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (s *staticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(r.PathValue("file"), "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	info, err := fs.Stat(s.fsys, name)
+	switch {
+	case err != nil:
+		if s.opts.SPAFallback && path.Ext(name) == "" {
+			s.serveFile(w, r, s.opts.Index, s.opts.CacheControl)
+			return
+		}
+		http.NotFound(w, r)
+	case info.IsDir():
+		s.serveDir(w, r, name)
+	default:
+		cacheControl := s.opts.CacheControl
+		if s.opts.Immutable(name) {
+			cacheControl = ImmutableCacheControl
+		}
+		s.serveFile(w, r, name, cacheControl)
+	}
+}
+
+// serveDir serves the index file or the listing of a directory.
+func (s *staticFiles) serveDir(w http.ResponseWriter, r *http.Request, name string) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		// relative links of the index need the trailing slash
+		target := path.Base(r.URL.Path) + "/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+
+	index := path.Join(name, s.opts.Index)
+	if info, err := fs.Stat(s.fsys, index); err == nil && !info.IsDir() {
+		s.serveFile(w, r, index, s.opts.CacheControl)
+		return
+	}
+
+	if !s.opts.Listing {
+		http.NotFound(w, r)
+		return
+	}
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = &url.URL{Path: "/" + strings.TrimPrefix(name+"/", "./"), RawQuery: r.URL.RawQuery}
+	http.FileServerFS(s.fsys).ServeHTTP(w, r2)
+}
+
+// serveFile serves a file or its precompressed sidecar.
+func (s *staticFiles) serveFile(w http.ResponseWriter, r *http.Request, name, cacheControl string) {
+	served, encoding := name, ""
+	accepted := parseAcceptEncoding(r.Header.Get("Accept-Encoding"))
+	for _, sidecar := range []struct{ encoding, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if accepted[sidecar.encoding] <= 0 {
+			continue
+		}
+		if info, err := fs.Stat(s.fsys, name+sidecar.ext); err == nil && !info.IsDir() {
+			served, encoding = name+sidecar.ext, sidecar.encoding
+			break
+		}
+	}
+
+	f, err := s.fsys.Open(served)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+	etag, err := s.etag(served, info, content)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	addVary(h, "Accept-Encoding")
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", cacheControl)
+	if encoding != "" {
+		h.Set("Content-Encoding", encoding)
+		// don't let the content of the sidecar be sniffed
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h.Set("Content-Type", contentType)
+	}
+
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// etag returns the ETag of a file, a hash of its content.
+// ETags are computed once per version of a file.
+func (s *staticFiles) etag(name string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	key := staticKey{name: name, size: info.Size(), modTime: info.ModTime()}
+
+	s.mu.Lock()
+	etag, ok := s.etags[key]
+	s.mu.Unlock()
+	if ok {
+		return etag, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag = `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+
+	s.mu.Lock()
+	s.etags[key] = etag
+	s.mu.Unlock()
+	return etag, nil
+}
@@ -0,0 +1,171 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_Static(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html":             {Data: []byte("<html>app</html>"), ModTime: modTime},
+		"assets/app.3f2a1b9c.js": {Data: []byte("console.log(1)"), ModTime: modTime},
+		"assets/app.css":         {Data: []byte("body{}"), ModTime: modTime},
+		"assets/app.css.gz":      {Data: []byte("gzipped css"), ModTime: modTime},
+		"assets/app.css.br":      {Data: []byte("brotli css"), ModTime: modTime},
+		"docs/readme.txt":        {Data: []byte("readme"), ModTime: modTime},
+	}
+
+	mark := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "true")
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	mux := muxify.NewMux()
+	web := mux.Subrouter().Prefix("/web")
+	web.Use(mark)
+	web.Static("/", fsys, muxify.StaticOptions{SPAFallback: true})
+	mux.Static("/files", fsys, muxify.StaticOptions{Listing: true})
+
+	testCases := map[string]struct {
+		path            string
+		header          map[string]string
+		expStatusCode   int
+		expBody         string
+		expCacheControl string
+		expEncoding     string
+	}{
+		"index": {
+			path:            "/web/",
+			expStatusCode:   http.StatusOK,
+			expBody:         "<html>app</html>",
+			expCacheControl: "no-cache",
+		},
+		"hashed asset": {
+			path:            "/web/assets/app.3f2a1b9c.js",
+			expStatusCode:   http.StatusOK,
+			expBody:         "console.log(1)",
+			expCacheControl: muxify.ImmutableCacheControl,
+		},
+		"brotli sidecar": {
+			path:            "/web/assets/app.css",
+			header:          map[string]string{"Accept-Encoding": "gzip, br"},
+			expStatusCode:   http.StatusOK,
+			expBody:         "brotli css",
+			expCacheControl: "no-cache",
+			expEncoding:     "br",
+		},
+		"gzip sidecar": {
+			path:            "/web/assets/app.css",
+			header:          map[string]string{"Accept-Encoding": "gzip"},
+			expStatusCode:   http.StatusOK,
+			expBody:         "gzipped css",
+			expCacheControl: "no-cache",
+			expEncoding:     "gzip",
+		},
+		"no sidecar": {
+			path:            "/web/assets/app.css",
+			expStatusCode:   http.StatusOK,
+			expBody:         "body{}",
+			expCacheControl: "no-cache",
+		},
+		"spa fallback": {
+			path:            "/web/users/42",
+			expStatusCode:   http.StatusOK,
+			expBody:         "<html>app</html>",
+			expCacheControl: "no-cache",
+		},
+		"missing asset": {
+			path:          "/web/assets/missing.js",
+			expStatusCode: http.StatusNotFound,
+		},
+		"no listing": {
+			path:          "/web/docs/",
+			expStatusCode: http.StatusNotFound,
+		},
+		"listing": {
+			path:          "/files/docs/",
+			expStatusCode: http.StatusOK,
+		},
+		"directory redirect": {
+			path:          "/files/docs",
+			expStatusCode: http.StatusMovedPermanently,
+		},
+		"no spa fallback": {
+			path:          "/files/users/42",
+			expStatusCode: http.StatusNotFound,
+		},
+		"not modified since": {
+			path:          "/files/docs/readme.txt",
+			header:        map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)},
+			expStatusCode: http.StatusNotModified,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expStatusCode {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatusCode, rec.Code)
+			}
+			if tc.expBody != "" && rec.Body.String() != tc.expBody {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expBody, rec.Body.String())
+			}
+			if got := rec.Header().Get("Cache-Control"); tc.expCacheControl != "" && got != tc.expCacheControl {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expCacheControl, got)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tc.expEncoding {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expEncoding, got)
+			}
+		})
+	}
+
+	t.Run("etag", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/web/assets/app.css", nil))
+		etag := rec.Header().Get("ETag")
+		if etag == "" || rec.Header().Get("X-Middleware") != "true" {
+			t.Fatalf("\nwant: etag and middleware\ngot: %v\n", rec.Header())
+		}
+		if got := rec.Header().Get("Content-Type"); got != "text/css; charset=utf-8" {
+			t.Errorf("\nwant: %v\ngot: %v\n", "text/css; charset=utf-8", got)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/web/assets/app.css", nil)
+		req.Header.Set("If-None-Match", etag)
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("\nwant: %v\ngot: %v\n", http.StatusNotModified, rec.Code)
+		}
+	})
+}
+
+func Test_IsHashedAsset(t *testing.T) {
+	testCases := map[string]bool{
+		"app.3f2a1b9c.js":           true,
+		"assets/index-BRl6Zx3e.css": true,
+		"app.js":                    false,
+		"main-component.js":         false,
+		"favicon.ico":               false,
+	}
+	for name, exp := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := muxify.IsHashedAsset(name); got != exp {
+				t.Errorf("\nwant: %v\ngot: %v\n", exp, got)
+			}
+		})
+	}
+}
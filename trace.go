@@ -0,0 +1,224 @@
+package muxify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SpanContext identifies a span according to W3C Trace Context.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	// Flags are the trace flags, bit 0 is the sampled flag.
+	Flags byte
+	// State is the vendor specific tracestate header.
+	State string
+}
+
+// IsValid reports whether the trace and span ID are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Sampled reports whether the sampled flag is set.
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&0x01 == 0x01
+}
+
+// Traceparent returns the traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), sc.Flags)
+}
+
+// ParseTraceparent parses traceparent and tracestate header values.
+func ParseTraceparent(traceparent, tracestate string) (SpanContext, error) {
+	var sc SpanContext
+
+	if len(traceparent) < 55 || traceparent[2] != '-' || traceparent[35] != '-' || traceparent[52] != '-' {
+		return sc, errors.New("muxify: malformed traceparent")
+	}
+	version := traceparent[:2]
+	if !isLowerHex(version) || version == "ff" ||
+		version == "00" && len(traceparent) != 55 ||
+		len(traceparent) > 55 && traceparent[55] != '-' {
+		return sc, errors.New("muxify: unsupported traceparent version")
+	}
+
+	traceID, spanID, flags := traceparent[3:35], traceparent[36:52], traceparent[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return sc, errors.New("muxify: malformed traceparent")
+	}
+	_, _ = hex.Decode(sc.TraceID[:], []byte(traceID))
+	_, _ = hex.Decode(sc.SpanID[:], []byte(spanID))
+	var f [1]byte
+	_, _ = hex.Decode(f[:], []byte(flags))
+	sc.Flags = f[0]
+	if !sc.IsValid() {
+		return SpanContext{}, errors.New("muxify: invalid traceparent ids")
+	}
+	sc.State = strings.TrimSpace(tracestate)
+
+	return sc, nil
+}
+
+// isLowerHex reports whether s only contains lowercase hex digits.
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Span is a unit of work recorded by a Tracer.
+type Span interface {
+	// SpanContext returns the identity of the span.
+	SpanContext() SpanContext
+	// SetAttribute sets an attribute of the span.
+	SetAttribute(key string, value any)
+	// SetStatus records the HTTP status code of the response.
+	SetStatus(code int)
+	// RecordError records an error.
+	RecordError(err error)
+	// End finishes the span.
+	End()
+}
+
+// Tracer starts spans. Implement it to connect a tracing system
+// like OpenTelemetry.
+type Tracer interface {
+	// Start starts a span that is a child of parent.
+	// The parent is invalid if the request did not carry a trace context.
+	Start(ctx context.Context, name string, parent SpanContext) (context.Context, Span)
+}
+
+// TraceOptions configures the Trace middleware.
+type TraceOptions struct {
+	// Tracer starts the spans.
+	// Defaults to a tracer that only propagates the trace context.
+	Tracer Tracer
+}
+
+// Trace returns a middleware that starts a span per request named after
+// the registered pattern. It continues the trace of the traceparent and
+// tracestate request headers and sends the trace context of the span
+// in the response headers. The response status and panics are recorded.
+func Trace(opts TraceOptions) Middleware {
+	if opts.Tracer == nil {
+		opts.Tracer = propagationTracer{}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parent, _ := ParseTraceparent(r.Header.Get("traceparent"), strings.Join(r.Header.Values("tracestate"), ","))
+
+			name := RoutePattern(r)
+			if name == "" {
+				name = r.Method
+			}
+
+			ctx, span := opts.Tracer.Start(r.Context(), name, parent)
+			ctx = context.WithValue(ctx, spanKey, span)
+
+			_, route := splitPattern(RoutePattern(r))
+			span.SetAttribute("http.request.method", r.Method)
+			span.SetAttribute("http.route", route)
+			span.SetAttribute("url.path", r.URL.Path)
+
+			InjectTraceContext(ctx, w.Header())
+
+			rw := WrapResponseWriter(w)
+			defer func() {
+				if p := recover(); p != nil {
+					span.RecordError(fmt.Errorf("panic: %v", p))
+					span.SetStatus(http.StatusInternalServerError)
+					span.End()
+					panic(p)
+				}
+
+				status := rw.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				span.SetAttribute("http.response.status_code", status)
+				span.SetStatus(status)
+				span.End()
+			}()
+
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	}
+}
+
+// SpanAttributes returns a middleware that sets attributes on the span
+// of the Trace middleware, e.g. to tag all routes of a subrouter.
+func SpanAttributes(attrs map[string]any) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := CurrentSpan(r.Context())
+			for k, v := range attrs {
+				span.SetAttribute(k, v)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CurrentSpan returns the span of the Trace middleware stored in ctx
+// or a no-op span if there is none.
+func CurrentSpan(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// InjectTraceContext sets the traceparent and tracestate headers
+// of the span in ctx, e.g. on outgoing requests.
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	sc := CurrentSpan(ctx).SpanContext()
+	if !sc.IsValid() {
+		return
+	}
+	h.Set("traceparent", sc.Traceparent())
+	if sc.State != "" {
+		h.Set("tracestate", sc.State)
+	}
+}
+
+// propagationTracer creates spans that only carry a trace context.
+type propagationTracer struct{}
+
+func (propagationTracer) Start(ctx context.Context, name string, parent SpanContext) (context.Context, Span) {
+	return ctx, noopSpan{sc: NewChildSpanContext(parent)}
+}
+
+// NewChildSpanContext returns a span context with a new span ID that
+// continues the trace of the parent or starts a new sampled trace
+// if the parent is invalid. Tracers can use it to create span IDs.
+func NewChildSpanContext(parent SpanContext) SpanContext {
+	sc := parent
+	if !parent.IsValid() {
+		sc = SpanContext{Flags: 0x01}
+		_, _ = rand.Read(sc.TraceID[:])
+	}
+	_, _ = rand.Read(sc.SpanID[:])
+	return sc
+}
+
+// noopSpan is a span that records nothing.
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (s noopSpan) SpanContext() SpanContext         { return s.sc }
+func (noopSpan) SetAttribute(key string, value any) {}
+func (noopSpan) SetStatus(code int)                 {}
+func (noopSpan) RecordError(err error)              {}
+func (noopSpan) End()                               {}
@@ -0,0 +1,228 @@
+package muxify_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+// recordingTracer records the spans it starts.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (tr *recordingTracer) Start(ctx context.Context, name string, parent muxify.SpanContext) (context.Context, muxify.Span) {
+	span := &recordingSpan{
+		name:   name,
+		parent: parent,
+		sc:     muxify.NewChildSpanContext(parent),
+		attrs:  map[string]any{},
+	}
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, span)
+	tr.mu.Unlock()
+	return ctx, span
+}
+
+type recordingSpan struct {
+	name   string
+	parent muxify.SpanContext
+	sc     muxify.SpanContext
+	attrs  map[string]any
+	status int
+	errs   []error
+	ended  bool
+}
+
+func (s *recordingSpan) SpanContext() muxify.SpanContext    { return s.sc }
+func (s *recordingSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+func (s *recordingSpan) SetStatus(code int)                 { s.status = code }
+func (s *recordingSpan) RecordError(err error)              { s.errs = append(s.errs, err) }
+func (s *recordingSpan) End()                               { s.ended = true }
+
+func Test_Trace(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	testCases := map[string]struct {
+		path          string
+		traceparent   string
+		expName       string
+		expParent     bool
+		expStatus     int
+		expAttributes map[string]any
+	}{
+		"ok - new trace": {
+			path:      "/api/users/1",
+			expName:   "GET /api/users/{id}",
+			expStatus: http.StatusOK,
+			expAttributes: map[string]any{
+				"http.route":                "/api/users/{id}",
+				"http.response.status_code": http.StatusOK,
+				"team":                      "users",
+			},
+		},
+		"ok - continued trace": {
+			path:        "/api/users/1",
+			traceparent: traceparent,
+			expName:     "GET /api/users/{id}",
+			expParent:   true,
+			expStatus:   http.StatusOK,
+		},
+		"invalid traceparent": {
+			path:        "/api/users/1",
+			traceparent: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			expName:     "GET /api/users/{id}",
+			expStatus:   http.StatusOK,
+		},
+		"ok - error status": {
+			path:      "/api/fail",
+			expName:   "GET /api/fail",
+			expStatus: http.StatusBadGateway,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			tracer := &recordingTracer{}
+
+			mux := muxify.NewMux()
+			mux.Use(muxify.Trace(muxify.TraceOptions{Tracer: tracer}))
+			api := mux.Subrouter().Prefix("/api")
+			api.HandleFunc("GET /fail", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+			})
+			users := api.Subrouter()
+			users.Use(muxify.SpanAttributes(map[string]any{"team": "users"}))
+			users.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+				// propagate to an outgoing request
+				out := http.Header{}
+				muxify.InjectTraceContext(r.Context(), out)
+				_, _ = w.Write([]byte(out.Get("traceparent")))
+			})
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.traceparent != "" {
+				req.Header.Set("traceparent", tc.traceparent)
+				req.Header.Set("tracestate", "vendor=muxify")
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if len(tracer.spans) != 1 {
+				t.Fatalf("\nwant: %v\ngot: %v\n", 1, len(tracer.spans))
+			}
+			span := tracer.spans[0]
+
+			if span.name != tc.expName {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expName, span.name)
+			}
+			if span.parent.IsValid() != tc.expParent {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expParent, span.parent.IsValid())
+			}
+			if tc.expParent {
+				if !strings.HasPrefix(span.sc.Traceparent(), traceparent[:36]) || span.sc.State != "vendor=muxify" {
+					t.Errorf("span does not continue the trace: %s %s", span.sc.Traceparent(), span.sc.State)
+				}
+			}
+			if span.status != tc.expStatus {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expStatus, span.status)
+			}
+			if !span.ended {
+				t.Errorf("span not ended")
+			}
+			for k, v := range tc.expAttributes {
+				if span.attrs[k] != v {
+					t.Errorf("%s\nwant: %v\ngot: %v\n", k, v, span.attrs[k])
+				}
+			}
+			if got := rec.Header().Get("traceparent"); got != span.sc.Traceparent() {
+				t.Errorf("\nwant: %v\ngot: %v\n", span.sc.Traceparent(), got)
+			}
+		})
+	}
+}
+
+func Test_Trace_Panic(t *testing.T) {
+	tracer := &recordingTracer{}
+
+	mux := muxify.NewMux()
+	mux.Use(muxify.Trace(muxify.TraceOptions{Tracer: tracer}))
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("no panic where panic is expected")
+			}
+		}()
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	span := tracer.spans[0]
+	if len(span.errs) != 1 || span.status != http.StatusInternalServerError || !span.ended {
+		t.Errorf("panic not recorded: %v %v %v", span.errs, span.status, span.ended)
+	}
+}
+
+func Test_ParseTraceparent(t *testing.T) {
+	testCases := map[string]struct {
+		traceparent string
+		expErr      bool
+		expSampled  bool
+	}{
+		"ok - sampled": {
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expSampled:  true,
+		},
+		"ok - not sampled": {
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+		"ok - future version": {
+			traceparent: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			expSampled:  true,
+		},
+		"version ff": {
+			traceparent: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expErr:      true,
+		},
+		"version 00 with extra data": {
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			expErr:      true,
+		},
+		"uppercase": {
+			traceparent: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01",
+			expErr:      true,
+		},
+		"zero span id": {
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+			expErr:      true,
+		},
+		"empty": {
+			expErr: true,
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			sc, err := muxify.ParseTraceparent(tc.traceparent, "")
+			if (err != nil) != tc.expErr {
+				t.Fatalf("\nwant: %v\ngot: %v\n", tc.expErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if sc.Sampled() != tc.expSampled {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expSampled, sc.Sampled())
+			}
+			if got := sc.Traceparent(); got != "00"+tc.traceparent[2:55] {
+				t.Errorf("\nwant: %v\ngot: %v\n", "00"+tc.traceparent[2:55], got)
+			}
+		})
+	}
+}
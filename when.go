@@ -0,0 +1,71 @@
+package muxify
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Predicate reports whether a request matches.
+// Predicates of middlewares used on a mux can see the registered pattern
+// that matched the request with RoutePattern.
+type Predicate func(r *http.Request) bool
+
+// When returns a middleware that applies mw only to requests
+// that match the predicate, e.g.
+//
+//	api.Use(muxify.When(muxify.OnMethods("POST", "PUT"), RequireJSON))
+func When(pred Predicate, mw Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		return forwardRegistrar(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if pred(r) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}), wrapped)
+	}
+}
+
+// OnMethods matches requests with one of the methods.
+func OnMethods(methods ...string) Predicate {
+	return func(r *http.Request) bool {
+		return slices.Contains(methods, r.Method)
+	}
+}
+
+// OnPathPrefix matches requests whose path starts with the prefix.
+func OnPathPrefix(prefix string) Predicate {
+	return func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}
+}
+
+// OnHeader matches requests with the header. If value is not empty
+// the header must have the value, compared case-insensitively.
+func OnHeader(name, value string) Predicate {
+	return func(r *http.Request) bool {
+		values := r.Header.Values(name)
+		if value == "" {
+			return len(values) > 0
+		}
+		return slices.ContainsFunc(values, func(v string) bool {
+			return strings.EqualFold(v, value)
+		})
+	}
+}
+
+// OnPatterns matches requests whose registered pattern is one of the patterns.
+func OnPatterns(patterns ...string) Predicate {
+	return func(r *http.Request) bool {
+		return slices.Contains(patterns, RoutePattern(r))
+	}
+}
+
+// Not matches requests that do not match the predicate.
+func Not(pred Predicate) Predicate {
+	return func(r *http.Request) bool {
+		return !pred(r)
+	}
+}
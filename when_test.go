@@ -0,0 +1,108 @@
+package muxify_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/42LM/muxify"
+)
+
+func Test_When(t *testing.T) {
+	mark := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Applied", "true")
+			next.ServeHTTP(w, r)
+		})
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	testCases := map[string]struct {
+		pred       muxify.Predicate
+		pattern    string
+		method     string
+		path       string
+		header     map[string]string
+		expApplied bool
+	}{
+		"method matches": {
+			pred:       muxify.OnMethods(http.MethodPost, http.MethodPut),
+			pattern:    "/users",
+			method:     http.MethodPut,
+			path:       "/users",
+			expApplied: true,
+		},
+		"method does not match": {
+			pred:    muxify.OnMethods(http.MethodPost, http.MethodPut),
+			pattern: "/users",
+			method:  http.MethodGet,
+			path:    "/users",
+		},
+		"path prefix matches": {
+			pred:       muxify.OnPathPrefix("/admin/"),
+			pattern:    "/admin/{page}",
+			method:     http.MethodGet,
+			path:       "/admin/users",
+			expApplied: true,
+		},
+		"path prefix does not match": {
+			pred:    muxify.OnPathPrefix("/admin/"),
+			pattern: "/users",
+			method:  http.MethodGet,
+			path:    "/users",
+		},
+		"header present": {
+			pred:       muxify.OnHeader("X-Debug", ""),
+			pattern:    "/",
+			method:     http.MethodGet,
+			path:       "/",
+			header:     map[string]string{"X-Debug": "1"},
+			expApplied: true,
+		},
+		"header value matches": {
+			pred:       muxify.OnHeader("Upgrade", "websocket"),
+			pattern:    "/",
+			method:     http.MethodGet,
+			path:       "/",
+			header:     map[string]string{"Upgrade": "WebSocket"},
+			expApplied: true,
+		},
+		"header missing": {
+			pred:    muxify.OnHeader("X-Debug", ""),
+			pattern: "/",
+			method:  http.MethodGet,
+			path:    "/",
+		},
+		"registered pattern matches": {
+			pred:       muxify.OnPatterns("/users/{id}"),
+			pattern:    "/users/{id}",
+			method:     http.MethodGet,
+			path:       "/users/1",
+			expApplied: true,
+		},
+		"negated": {
+			pred:    muxify.Not(muxify.OnPatterns("/users/{id}")),
+			pattern: "/users/{id}",
+			method:  http.MethodGet,
+			path:    "/users/1",
+		},
+	}
+	for tname, tc := range testCases {
+		t.Run(tname, func(t *testing.T) {
+			mux := muxify.NewMux()
+			mux.Use(muxify.When(tc.pred, mark))
+			mux.HandleFunc(tc.pattern, handler)
+
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if applied := rec.Header().Get("X-Applied") == "true"; applied != tc.expApplied {
+				t.Errorf("\nwant: %v\ngot: %v\n", tc.expApplied, applied)
+			}
+		})
+	}
+}